@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/controller"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// snapshotから読み込んだ場合のクラスター名
+const snapshotClusterName = "snapshot"
+
+// NewClusters はコマンドライン引数に従ってクラスターの一覧を作る．
+// kubeconfigの全てのcontextをクラスターとし，接続の設定に失敗したクラスターはエラーとして登録して他のクラスターは使えるようにする
+func NewClusters(options Options) (*controller.Clusters, error) {
+	clusters := controller.NewClusters()
+	if options.Snapshot != "" {
+		clientset, dynamicClient, err := NewSnapshotClient(options.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		if err := clusters.Add(snapshotClusterName, "", "", controller.NewController(clientset, dynamicClient), nil); err != nil {
+			return nil, err
+		}
+		return clusters, nil
+	}
+
+	files, err := kubeconfigFiles(options.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	defaultName := ""
+	// context名ごとのクラスター名．--default-clusterにはファイル名を付ける前のcontext名も指定できる
+	contextClusters := make(map[string][]string)
+	// ディレクトリの複数のファイルで同じcontext名が使われている場合はファイル名を付けて区別する
+	contextFiles := make(map[string]int)
+	configs := make([]*clientcmdapi.Config, 0, len(files))
+	for _, file := range files {
+		rawConfig, err := clientcmd.LoadFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		configs = append(configs, rawConfig)
+		for name := range rawConfig.Contexts {
+			contextFiles[name]++
+		}
+	}
+
+	for i, rawConfig := range configs {
+		contexts := make([]string, 0, len(rawConfig.Contexts))
+		for name := range rawConfig.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+
+		for _, contextName := range contexts {
+			name := contextName
+			if contextFiles[contextName] > 1 {
+				name = strings.TrimSuffix(filepath.Base(files[i]), filepath.Ext(files[i])) + "-" + contextName
+			}
+			// クラスター名はURLのパスに使うので/を含めない
+			name = strings.ReplaceAll(name, "/", "-")
+			contextClusters[contextName] = append(contextClusters[contextName], name)
+			if defaultName == "" && contextName == rawConfig.CurrentContext {
+				defaultName = name
+			}
+
+			ctrl, server, err := newContextController(rawConfig, contextName)
+			if err != nil {
+				fmt.Printf("クラスター%sの設定に失敗: %v\n", name, err)
+			}
+			if err := clusters.Add(name, contextName, server, ctrl, err); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if options.DefaultCluster != "" {
+		defaultName = options.DefaultCluster
+		if names, ok := contextClusters[defaultName]; ok && !clusters.Has(defaultName) {
+			if len(names) > 1 {
+				return nil, fmt.Errorf("context %q is defined in multiple kubeconfig files, use one of %s for --default-cluster", defaultName, strings.Join(names, ", "))
+			}
+			defaultName = names[0]
+		}
+	}
+	if defaultName != "" {
+		if err := clusters.SetDefault(defaultName); err != nil {
+			return nil, err
+		}
+	}
+	return clusters, nil
+}
+
+// kubeconfigFiles はpathがディレクトリの場合はその直下のファイルを名前順に返す
+func kubeconfigFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no kubeconfig files", path)
+	}
+	return files, nil
+}
+
+// newContextController はkubeconfigのcontextのクラスターに接続するcontrollerと，APIサーバーのURLを返す
+func newContextController(rawConfig *clientcmdapi.Config, contextName string) (*controller.Ctrl, string, error) {
+	var server string
+	if context, ok := rawConfig.Contexts[contextName]; ok {
+		if cluster, ok := rawConfig.Clusters[context.Cluster]; ok {
+			server = cluster.Server
+		}
+	}
+
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*rawConfig, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return nil, server, err
+	}
+	clientset, err := NewClient(restConfig)
+	if err != nil {
+		return nil, server, err
+	}
+	dynamicClient, err := NewDynamicClient(restConfig)
+	if err != nil {
+		return nil, server, err
+	}
+	return controller.NewController(clientset, dynamicClient), restConfig.Host, nil
+}
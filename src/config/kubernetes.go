@@ -2,21 +2,40 @@ package config
 
 import (
 	"flag"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/rest"
 	"path/filepath"
 )
 
-func NewClient() (*kubernetes.Clientset, error) {
-	var kubeconfig *string
-	kubeconfig = flag.String("kubeconfig", filepath.Join("/", "go", "src", "app", ".kube", "config"), "absolute path to the kubeconfig file")
+// Options はコマンドライン引数
+type Options struct {
+	// kubeconfigのファイル，またはkubeconfigのファイルを含むディレクトリ．全てのcontextをクラスターとして読み込む
+	Kubeconfig string
+	// クラスター名を指定しないAPIとdumpで使うクラスター．指定しない場合はkubeconfigのcurrent-context
+	DefaultCluster string
+	// 指定された場合はAPIサーバーに接続せず，このファイルまたはディレクトリのリソースを使う
+	Snapshot string
+	// 指定された場合はクラスターのリソースをこのディレクトリに書き出して終了する
+	Dump string
+}
+
+func ParseFlags() Options {
+	var options Options
+	flag.StringVar(&options.Kubeconfig, "kubeconfig", filepath.Join("/", "go", "src", "app", ".kube", "config"), "absolute path to the kubeconfig file, or a directory of kubeconfig files")
+	flag.StringVar(&options.DefaultCluster, "default-cluster", "", "cluster served by the routes without /api/clusters/:cluster (defaults to the current-context)")
+	flag.StringVar(&options.Snapshot, "snapshot", "", "serve the API from a directory of YAML/JSON files or a multi-document dump instead of a cluster")
+	flag.StringVar(&options.Dump, "dump", "", "write a snapshot of the cluster to this directory and exit")
 	flag.Parse()
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	if err != nil {
-		return nil, err
-	}
+	return options
+}
 
+func NewClient(config *rest.Config) (kubernetes.Interface, error) {
 	// create the clientset
 	return kubernetes.NewForConfig(config)
 }
+
+// NewDynamicClient はCalico等のCRDを取得するためのclientを作る
+func NewDynamicClient(config *rest.Config) (dynamic.Interface, error) {
+	return dynamic.NewForConfig(config)
+}
@@ -7,16 +7,36 @@ import (
 	"time"
 )
 
-func GetRouter(c *controller.Ctrl) *gin.Engine {
+func GetRouter(clusters *controller.Clusters) *gin.Engine {
 	router := gin.Default()
 	router.Use(newCorsConfig())
+	// readinessProbe用
+	router.GET("readyz", clusters.GetReadiness())
 	api := router.Group("api")
-	api.GET("nodes", c.GetNodeList())
-	api.GET("nodes/:name", c.GetNodeDetail())
-	api.GET("pods/:name", c.GetPodDetail())
+	api.GET("clusters", clusters.GetClusterList())
+	api.GET("clusters/:cluster", clusters.GetClusterDetail())
+	// クラスター名を指定しないAPIはデフォルトのクラスターを使う
+	registerRoutes(api, clusters.HandleDefault)
+	registerRoutes(api.Group("clusters/:cluster"), clusters.Handle)
 	return router
 }
 
+// registerRoutes はクラスターごとのAPIを登録する．handleでhandlerを実行するクラスターを選ぶ
+func registerRoutes(api *gin.RouterGroup, handle func(handler func(c *controller.Ctrl) gin.HandlerFunc) gin.HandlerFunc) {
+	api.GET("nodes", handle((*controller.Ctrl).GetNodeList))
+	api.GET("nodes/:name", handle((*controller.Ctrl).GetNodeDetail))
+	api.GET("pods/:name", handle((*controller.Ctrl).GetPodDetail))
+	api.GET("namespaces/:namespace/pods/:name", handle((*controller.Ctrl).GetNamespacedPodDetail))
+	api.GET("reachability", handle((*controller.Ctrl).GetReachability))
+	api.GET("reachability/matrix", handle((*controller.Ctrl).GetReachabilityMatrix))
+	api.POST("simulate", handle((*controller.Ctrl).Simulate))
+	api.GET("policies/lint", handle((*controller.Ctrl).GetPolicyLint))
+	api.GET("services", handle((*controller.Ctrl).GetServiceList))
+	api.GET("namespaces/:namespace/services/:name", handle((*controller.Ctrl).GetServiceDetail))
+	api.GET("exposure", handle((*controller.Ctrl).GetExposure))
+	api.GET("watch", handle((*controller.Ctrl).Watch))
+}
+
 func newCorsConfig() gin.HandlerFunc {
 	config := cors.New(cors.Config{
 		// アクセスを許可したいアクセス元
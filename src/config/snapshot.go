@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/controller"
+	"io"
+	"io/fs"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewSnapshotClient はAPIサーバーの代わりにsnapshotのファイルからリソースを返すclientを作る．
+// pathはYAML/JSONのファイルを含むディレクトリ，または複数ドキュメントのYAMLファイル(kubectl get -o yamlの出力など)
+func NewSnapshotClient(path string) (kubernetes.Interface, dynamic.Interface, error) {
+	objects, err := loadSnapshot(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	typed := make([]runtime.Object, 0, len(objects))
+	custom := make([]runtime.Object, 0)
+	seen := make(map[string]string)
+	for _, obj := range objects {
+		key := obj.object.GroupVersionKind().String() + "/" + obj.object.GetNamespace() + "/" + obj.object.GetName()
+		if file, ok := seen[key]; ok {
+			return nil, nil, fmt.Errorf("%s: %s %s is already defined in %s", obj.file, obj.object.GetKind(), obj.object.GetName(), file)
+		}
+		seen[key] = obj.file
+
+		// client-goの型があるリソースはclientsetから，CRDはdynamic clientから取得する
+		gvk := obj.object.GroupVersionKind()
+		if !scheme.Scheme.Recognizes(gvk) {
+			custom = append(custom, &obj.object)
+			continue
+		}
+		v, err := scheme.Scheme.New(gvk)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", obj.file, err)
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.object.Object, v); err != nil {
+			return nil, nil, fmt.Errorf("%s: %s %s: %w", obj.file, obj.object.GetKind(), obj.object.GetName(), err)
+		}
+		typed = append(typed, v)
+	}
+	fmt.Printf("snapshot: %d件のリソースを読み込みました\n", len(objects))
+
+	return fake.NewSimpleClientset(typed...),
+		dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), controller.CustomResourceListKinds(), custom...),
+		nil
+}
+
+type snapshotObject struct {
+	file   string
+	object unstructured.Unstructured
+}
+
+// ディレクトリの場合は配下の.yaml, .yml, .jsonのファイルを全て読み込む
+func loadSnapshot(path string) ([]snapshotObject, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return loadSnapshotFile(path)
+	}
+
+	res := make([]snapshotObject, 0)
+	err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		objects, err := loadSnapshotFile(file)
+		if err != nil {
+			return err
+		}
+		res = append(res, objects...)
+		return nil
+	})
+	return res, err
+}
+
+// 複数ドキュメントのYAML, JSONを読み込む．kind: Listはitemsに展開する
+func loadSnapshotFile(file string) ([]snapshotObject, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := make([]snapshotObject, 0)
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var obj unstructured.Unstructured
+		if err := decoder.Decode(&obj.Object); errors.Is(err, io.EOF) {
+			return res, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		// 空のドキュメント
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if !obj.IsList() {
+			if obj.GetKind() == "" {
+				return nil, fmt.Errorf("%s: object %q has no kind", file, obj.GetName())
+			}
+			res = append(res, snapshotObject{file: file, object: obj})
+			continue
+		}
+		list, err := obj.ToList()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, item := range list.Items {
+			res = append(res, snapshotObject{file: file, object: item})
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	adminNetworkPolicyResource         = schema.GroupVersionResource{Group: "policy.networking.k8s.io", Version: "v1alpha1", Resource: "adminnetworkpolicies"}
+	baselineAdminNetworkPolicyResource = schema.GroupVersionResource{Group: "policy.networking.k8s.io", Version: "v1alpha1", Resource: "baselineadminnetworkpolicies"}
+)
+
+// AdminNetworkPolicy, BaselineAdminNetworkPolicyを取得する．変換できないオブジェクトは警告を残して除外する
+func (c *Ctrl) listAdminNetworkPolicies(resource schema.GroupVersionResource) ([]policy.AdminNetworkPolicy, []policy.Warning, error) {
+	items, err := c.cache.listCustomResources(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	policies := make([]policy.AdminNetworkPolicy, 0, len(items))
+	warnings := make([]policy.Warning, 0)
+	for _, item := range items {
+		p, err := policy.NewAdminNetworkPolicy(item)
+		if err != nil {
+			warnings = append(warnings, policy.NewObjectWarning(item, err))
+			continue
+		}
+		policies = append(policies, p)
+	}
+	return policies, warnings, nil
+}
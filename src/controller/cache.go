@@ -0,0 +1,475 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	netlisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pod名から全namespaceのPodを引くためのindex
+const podNameIndex = "name"
+
+// clusterCache はPod, Node, Namespace, Network Policy, Service, EndpointSlice, Ingressと，Calico等のpolicyのCRDをinformerで監視して保持する．
+// リクエストごとにAPIサーバーから一覧を取得する代わりにここから読む
+type clusterCache struct {
+	factory         informers.SharedInformerFactory
+	dynamicClient   dynamic.Interface
+	customFactory   dynamicinformer.DynamicSharedInformerFactory
+	podIndexer      cache.Indexer
+	pods            corelisters.PodLister
+	nodes           corelisters.NodeLister
+	namespaces      corelisters.NamespaceLister
+	networkPolicies netlisters.NetworkPolicyLister
+	services        corelisters.ServiceLister
+	endpointSlices  discoverylisters.EndpointSliceLister
+	ingresses       netlisters.IngressLister
+	hasSynced       []cache.InformerSynced
+	// 起動時にインストールされていたpolicyのCRDのlister．同期の完了前に書き込まれるのでmuで保護する
+	customListers map[schema.GroupVersionResource]cache.GenericLister
+	// 権限がない等で監視できなかったpolicyのCRDと，その理由
+	unavailableResources map[schema.GroupVersionResource]error
+
+	mu     sync.RWMutex
+	synced bool
+	// 初回の同期が完了した時刻，またはその後に最後に変更を受け取った時刻
+	lastSynced time.Time
+	// APIサーバーからの一覧取得，監視に失敗した最後のエラーと時刻
+	lastError     error
+	lastErrorTime time.Time
+
+	// /api/watchの購読者
+	watchMu     sync.Mutex
+	subscribers map[*watchSubscriber]struct{}
+}
+
+func newClusterCache(kubeClient kubernetes.Interface, dynamicClient dynamic.Interface) *clusterCache {
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	podInformer := factory.Core().V1().Pods()
+	nodeInformer := factory.Core().V1().Nodes()
+	namespaceInformer := factory.Core().V1().Namespaces()
+	networkPolicyInformer := factory.Networking().V1().NetworkPolicies()
+	serviceInformer := factory.Core().V1().Services()
+	endpointSliceInformer := factory.Discovery().V1().EndpointSlices()
+	ingressInformer := factory.Networking().V1().Ingresses()
+
+	podInformer.Informer().AddIndexers(cache.Indexers{
+		podNameIndex: func(obj interface{}) ([]string, error) {
+			return []string{obj.(*v1.Pod).Name}, nil
+		},
+	})
+
+	c := &clusterCache{
+		factory:         factory,
+		podIndexer:      podInformer.Informer().GetIndexer(),
+		pods:            podInformer.Lister(),
+		nodes:           nodeInformer.Lister(),
+		namespaces:      namespaceInformer.Lister(),
+		networkPolicies: networkPolicyInformer.Lister(),
+		services:        serviceInformer.Lister(),
+		endpointSlices:  endpointSliceInformer.Lister(),
+		ingresses:       ingressInformer.Lister(),
+		customListers:   make(map[schema.GroupVersionResource]cache.GenericLister),
+		subscribers:     make(map[*watchSubscriber]struct{}),
+
+		unavailableResources: make(map[schema.GroupVersionResource]error),
+	}
+	if dynamicClient != nil {
+		c.dynamicClient = dynamicClient
+		c.customFactory = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+	}
+	for _, informer := range []cache.SharedIndexInformer{
+		podInformer.Informer(), nodeInformer.Informer(), namespaceInformer.Informer(), networkPolicyInformer.Informer(),
+		serviceInformer.Informer(), endpointSliceInformer.Informer(), ingressInformer.Informer(),
+	} {
+		c.addInformer(informer)
+	}
+	c.addWatchHandlers(podInformer.Informer(), nodeInformer.Informer(), namespaceInformer.Informer(), networkPolicyInformer.Informer())
+	return c
+}
+
+// informerの変更で最終同期時刻を更新し，一覧取得，監視のエラーを記録する
+func (c *clusterCache) addInformer(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.touch() },
+		UpdateFunc: func(interface{}, interface{}) { c.touch() },
+		DeleteFunc: func(interface{}) { c.touch() },
+	})
+	informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		c.setError(err)
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+	c.hasSynced = append(c.hasSynced, informer.HasSynced)
+}
+
+// start はinformerを起動し，初回の同期の完了をバックグラウンドで待つ
+func (c *clusterCache) start(stopCh <-chan struct{}) {
+	c.factory.Start(stopCh)
+	go func() {
+		now := time.Now()
+		if !c.startCustomResourceInformers(stopCh) {
+			return
+		}
+		if !cache.WaitForCacheSync(stopCh, c.hasSynced...) {
+			return
+		}
+		c.mu.Lock()
+		c.synced = true
+		c.lastSynced = time.Now()
+		c.mu.Unlock()
+		fmt.Printf("キャッシュ同期時間: %v\n", time.Since(now)) // 計測用
+	}()
+}
+
+// インストールされているpolicyのCRDを調べてinformerを起動する．APIサーバーに接続できない間は再試行する．
+// 権限がない等の再試行しても解決しないエラーのCRDは監視せずにunavailableResourcesに記録する．
+// 起動後にインストールされたCRDは再起動するまで監視しない
+func (c *clusterCache) startCustomResourceInformers(stopCh <-chan struct{}) bool {
+	if c.dynamicClient == nil {
+		return true
+	}
+
+	for _, resource := range policyCustomResources {
+		installed := false
+		err := wait.PollImmediateUntil(5*time.Second, func() (bool, error) {
+			_, err := c.dynamicClient.Resource(resource).List(context.TODO(), metav1.ListOptions{Limit: 1})
+			if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				return true, nil
+			}
+			if err != nil && isRetryableError(err) {
+				c.setError(fmt.Errorf("%s: %w", resource.GroupResource(), err))
+				return false, nil
+			}
+			if err != nil {
+				c.mu.Lock()
+				c.unavailableResources[resource] = err
+				c.mu.Unlock()
+				return true, nil
+			}
+			installed = true
+			return true, nil
+		}, stopCh)
+		if err != nil {
+			return false
+		}
+		if !installed {
+			continue
+		}
+
+		informer := c.customFactory.ForResource(resource)
+		c.addInformer(informer.Informer())
+		c.addCustomResourceWatchHandler(resource, informer.Informer())
+		c.mu.Lock()
+		c.customListers[resource] = informer.Lister()
+		c.mu.Unlock()
+	}
+	c.customFactory.Start(stopCh)
+	return true
+}
+
+// APIサーバーに接続できない，タイムアウト，過負荷等の時間をおけば解決しうるエラーか
+func isRetryableError(err error) bool {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return true
+	}
+	return apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsUnexpectedServerError(err)
+}
+
+// 同期前の初回の一覧取得による変更は同期完了時にまとめて記録する
+func (c *clusterCache) touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.synced {
+		c.lastSynced = time.Now()
+	}
+}
+
+func (c *clusterCache) setError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = err
+	c.lastErrorTime = time.Now()
+}
+
+func (c *clusterCache) status() (bool, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.synced, c.lastSynced
+}
+
+// health は同期の状態と，最後の同期より後に起きたエラーを返す．再接続して再同期した後のエラーは返さない
+func (c *clusterCache) health() (bool, time.Time, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lastError != nil && (!c.synced || c.lastErrorTime.After(c.lastSynced)) {
+		return c.synced, c.lastSynced, c.lastError
+	}
+	return c.synced, c.lastSynced, nil
+}
+
+// 監視できなかったpolicyのCRDの"resource.group"ごとの理由
+func (c *clusterCache) unavailable() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make(map[string]string, len(c.unavailableResources))
+	for resource, err := range c.unavailableResources {
+		res[resource.GroupResource().String()] = err.Error()
+	}
+	return res
+}
+
+func (c *clusterCache) listPods() ([]v1.Pod, error) {
+	pods, err := c.pods.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		res = append(res, *pod)
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+// 名前が一致するPodを全namespaceから探す
+func (c *clusterCache) listPodsByName(name string) ([]v1.Pod, error) {
+	objs, err := c.podIndexer.ByIndex(podNameIndex, name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		res = append(res, *obj.(*v1.Pod))
+	}
+	return res, nil
+}
+
+func (c *clusterCache) getPod(namespace string, name string) (v1.Pod, error) {
+	pod, err := c.pods.Pods(namespace).Get(name)
+	if err != nil {
+		return v1.Pod{}, err
+	}
+	return *pod, nil
+}
+
+func (c *clusterCache) listNodes() ([]v1.Node, error) {
+	nodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		res = append(res, *node)
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+func (c *clusterCache) getNode(name string) (v1.Node, error) {
+	node, err := c.nodes.Get(name)
+	if err != nil {
+		return v1.Node{}, err
+	}
+	return *node, nil
+}
+
+func (c *clusterCache) listNamespaces() ([]v1.Namespace, error) {
+	namespaces, err := c.namespaces.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]v1.Namespace, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		res = append(res, *namespace)
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+func (c *clusterCache) listNetworkPolicies() ([]netv1.NetworkPolicy, error) {
+	policies, err := c.networkPolicies.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]netv1.NetworkPolicy, 0, len(policies))
+	for _, policy := range policies {
+		res = append(res, *policy)
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+// listServices はnamespaceのServiceの一覧を返す．namespaceが空の場合は全namespace
+func (c *clusterCache) listServices(namespace string) ([]v1.Service, error) {
+	var services []*v1.Service
+	var err error
+	if namespace == "" {
+		services, err = c.services.List(labels.Everything())
+	} else {
+		services, err = c.services.Services(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]v1.Service, 0, len(services))
+	for _, service := range services {
+		res = append(res, *service)
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+func (c *clusterCache) getService(namespace string, name string) (v1.Service, error) {
+	service, err := c.services.Services(namespace).Get(name)
+	if err != nil {
+		return v1.Service{}, err
+	}
+	return *service, nil
+}
+
+// listEndpointSlices はnamespaceのEndpointSliceのうちselectorにマッチするものを返す．namespaceが空の場合は全namespace
+func (c *clusterCache) listEndpointSlices(namespace string, selector labels.Selector) ([]discoveryv1.EndpointSlice, error) {
+	var slices []*discoveryv1.EndpointSlice
+	var err error
+	if namespace == "" {
+		slices, err = c.endpointSlices.List(selector)
+	} else {
+		slices, err = c.endpointSlices.EndpointSlices(namespace).List(selector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]discoveryv1.EndpointSlice, 0, len(slices))
+	for _, slice := range slices {
+		res = append(res, *slice)
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+// listIngresses はnamespaceのIngressの一覧を返す．namespaceが空の場合は全namespace
+func (c *clusterCache) listIngresses(namespace string) ([]netv1.Ingress, error) {
+	var ingresses []*netv1.Ingress
+	var err error
+	if namespace == "" {
+		ingresses, err = c.ingresses.List(labels.Everything())
+	} else {
+		ingresses, err = c.ingresses.Ingresses(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]netv1.Ingress, 0, len(ingresses))
+	for _, ingress := range ingresses {
+		res = append(res, *ingress)
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+// listCustomResources はpolicyのCRDの一覧を返す．CRDがインストールされていないクラスターでは空を返す
+func (c *clusterCache) listCustomResources(resource schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	c.mu.RLock()
+	lister, ok := c.customListers[resource]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+
+	objs, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			res = append(res, *u)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return lessObject(&res[i], &res[j]) })
+	return res, nil
+}
+
+// listerの一覧は順不同なので，APIサーバーと同じnamespace, 名前の順に並べる
+func lessObject(a metav1.Object, b metav1.Object) bool {
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+	return a.GetName() < b.GetName()
+}
+
+// StartCache はPod, Node, Namespace, Network Policy, Service, EndpointSlice, IngressとpolicyのCRDのキャッシュを起動する．同期が完了するまでAPIは503を返す
+func (c *Ctrl) StartCache(stopCh <-chan struct{}) {
+	c.cache.start(stopCh)
+}
+
+// RequireCacheSynced はキャッシュの同期が完了するまでリクエストを503で拒否し，完了後はX-Last-Syncedヘッダーを付ける
+func (c *Ctrl) RequireCacheSynced() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		synced, lastSynced, err := c.cache.health()
+		if !synced {
+			message := "cache is not synced yet"
+			if err != nil {
+				message += ": " + err.Error()
+			}
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": message,
+			})
+			return
+		}
+		ctx.Header("X-Last-Synced", lastSynced.UTC().Format(time.RFC3339))
+	}
+}
+
+// Health はキャッシュの同期が完了しているか，最後に同期した時刻，同期後に起きたAPIサーバーとの通信のエラーを返す
+func (c *Ctrl) Health() (bool, time.Time, error) {
+	return c.cache.health()
+}
+
+// GetReadiness はキャッシュの同期が完了しているかを返す．readinessProbe用．
+// 権限がない等で監視できないpolicyのCRDはunavailable_resourcesに入れ，同期の完了を妨げない
+func (c *Ctrl) GetReadiness() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		synced, lastSynced, err := c.cache.health()
+		status := http.StatusOK
+		if !synced {
+			status = http.StatusServiceUnavailable
+		}
+		res := gin.H{
+			"ready":                 synced,
+			"last_synced":           nil,
+			"unavailable_resources": c.cache.unavailable(),
+		}
+		if synced {
+			res["last_synced"] = lastSynced
+		}
+		if err != nil {
+			res["error"] = err.Error()
+		}
+		ctx.JSON(status, res)
+	}
+}
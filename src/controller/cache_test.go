@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStartCacheWithForbiddenCustomResource(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), CustomResourceListKinds(),
+		newTestObject("cilium.io/v2", "CiliumNetworkPolicy", "default", "web", map[string]interface{}{}),
+	)
+	// Calicoのtierを一覧する権限がない
+	dynamicClient.PrependReactor("list", "tiers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(calicoTierResource.GroupResource(), "", nil)
+	})
+	c := NewController(fake.NewSimpleClientset(), dynamicClient)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.StartCache(stopCh)
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		synced, _ := c.cache.status()
+		return synced, nil
+	})
+	if err != nil {
+		t.Fatalf("cache did not sync: %v", err)
+	}
+
+	unavailable := c.cache.unavailable()
+	if _, ok := unavailable[calicoTierResource.GroupResource().String()]; !ok || len(unavailable) != 1 {
+		t.Errorf("unavailable() = %v, want only %s", unavailable, calicoTierResource.GroupResource())
+	}
+	policies, _, err := c.listCiliumPolicies()
+	if err != nil || len(policies) != 1 {
+		t.Errorf("listCiliumPolicies() = %+v, %v", policies, err)
+	}
+}
+
+func TestListServicesAndEndpointSlices(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "api"}},
+		&discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-abc", Labels: map[string]string{discoveryv1.LabelServiceName: "web"}}},
+		&discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db-abc", Labels: map[string]string{discoveryv1.LabelServiceName: "db"}}},
+	)
+	c := NewController(kubeClient, nil)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.StartCache(stopCh)
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		synced, _ := c.cache.status()
+		return synced, nil
+	})
+	if err != nil {
+		t.Fatalf("cache did not sync: %v", err)
+	}
+
+	services, err := c.cache.listServices("")
+	if err != nil || len(services) != 2 || services[0].Name != "web" || services[1].Name != "api" {
+		t.Errorf("listServices(\"\") = %+v, %v", services, err)
+	}
+	services, err = c.cache.listServices("other")
+	if err != nil || len(services) != 1 || services[0].Name != "api" {
+		t.Errorf("listServices(\"other\") = %+v, %v", services, err)
+	}
+	if _, err := c.cache.getService("default", "api"); !apierrors.IsNotFound(err) {
+		t.Errorf("getService() error = %v, want NotFound", err)
+	}
+
+	slices, err := c.cache.listEndpointSlices("default", labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: "web"}))
+	if err != nil || len(slices) != 1 || slices[0].Name != "web-abc" {
+		t.Errorf("listEndpointSlices() = %+v, %v", slices, err)
+	}
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	calicoNetworkPolicyResource       = schema.GroupVersionResource{Group: "crd.projectcalico.org", Version: "v1", Resource: "networkpolicies"}
+	calicoGlobalNetworkPolicyResource = schema.GroupVersionResource{Group: "crd.projectcalico.org", Version: "v1", Resource: "globalnetworkpolicies"}
+	calicoTierResource                = schema.GroupVersionResource{Group: "crd.projectcalico.org", Version: "v1", Resource: "tiers"}
+)
+
+// CalicoのNetworkPolicy, GlobalNetworkPolicy, Tierを取得する．CalicoのCRDがないクラスターでは空を返す．
+// 変換できないオブジェクトは警告を残して除外する
+func (c *Ctrl) listCalicoPolicies() ([]policy.CalicoPolicy, []policy.CalicoTier, []policy.Warning, error) {
+	policies := make([]policy.CalicoPolicy, 0)
+	warnings := make([]policy.Warning, 0)
+	for _, resource := range []schema.GroupVersionResource{calicoNetworkPolicyResource, calicoGlobalNetworkPolicyResource} {
+		items, err := c.cache.listCustomResources(resource)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, item := range items {
+			p, err := policy.NewCalicoPolicy(item)
+			if err != nil {
+				warnings = append(warnings, policy.NewObjectWarning(item, err))
+				continue
+			}
+			policies = append(policies, p)
+		}
+	}
+
+	items, err := c.cache.listCustomResources(calicoTierResource)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tiers := make([]policy.CalicoTier, 0, len(items))
+	for _, item := range items {
+		t, err := policy.NewCalicoTier(item)
+		if err != nil {
+			warnings = append(warnings, policy.NewObjectWarning(item, err))
+			continue
+		}
+		tiers = append(tiers, t)
+	}
+
+	return policies, tiers, warnings, nil
+}
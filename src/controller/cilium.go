@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	ciliumNetworkPolicyResource            = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"}
+	ciliumClusterwideNetworkPolicyResource = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumclusterwidenetworkpolicies"}
+)
+
+// CiliumNetworkPolicy, CiliumClusterwideNetworkPolicyを取得する．変換できないオブジェクトは警告を残して除外する
+func (c *Ctrl) listCiliumPolicies() ([]policy.CiliumPolicy, []policy.Warning, error) {
+	policies := make([]policy.CiliumPolicy, 0)
+	warnings := make([]policy.Warning, 0)
+	for _, resource := range []schema.GroupVersionResource{ciliumNetworkPolicyResource, ciliumClusterwideNetworkPolicyResource} {
+		items, err := c.cache.listCustomResources(resource)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, item := range items {
+			p, err := policy.NewCiliumPolicy(item)
+			if err != nil {
+				warnings = append(warnings, policy.NewObjectWarning(item, err))
+				continue
+			}
+			policies = append(policies, p)
+		}
+	}
+	return policies, warnings, nil
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// Cluster は/api/clusters/:clusterで選べる1つのクラスター
+type Cluster struct {
+	Name    string
+	Context string
+	Server  string
+	// 接続の設定に失敗した場合はnil
+	Ctrl *Ctrl
+	err  error
+}
+
+// Clusters はkubeconfigから読み込んだクラスターの一覧．/api/clusters/:cluster以外のAPIはデフォルトのクラスターを使う
+type Clusters struct {
+	clusters    []*Cluster
+	byName      map[string]*Cluster
+	defaultName string
+}
+
+func NewClusters() *Clusters {
+	return &Clusters{byName: make(map[string]*Cluster)}
+}
+
+// Add はクラスターを追加する．errがnilでない場合は接続の設定に失敗したクラスターとして登録し，そのAPIはエラーを返す
+func (cs *Clusters) Add(name string, context string, server string, ctrl *Ctrl, err error) error {
+	if _, ok := cs.byName[name]; ok {
+		return fmt.Errorf("duplicate cluster name %q", name)
+	}
+	cluster := &Cluster{Name: name, Context: context, Server: server, Ctrl: ctrl, err: err}
+	cs.clusters = append(cs.clusters, cluster)
+	cs.byName[name] = cluster
+	if cs.defaultName == "" {
+		cs.defaultName = name
+	}
+	return nil
+}
+
+// Has はnameのクラスターがあるかを返す
+func (cs *Clusters) Has(name string) bool {
+	_, ok := cs.byName[name]
+	return ok
+}
+
+// SetDefault はクラスター名を指定しないAPIで使うクラスターを変える．指定しない場合は最初に追加したクラスター
+func (cs *Clusters) SetDefault(name string) error {
+	if _, ok := cs.byName[name]; !ok {
+		names := make([]string, 0, len(cs.clusters))
+		for _, cluster := range cs.clusters {
+			names = append(names, cluster.Name)
+		}
+		return fmt.Errorf("cluster %q not found (available: %s)", name, strings.Join(names, ", "))
+	}
+	cs.defaultName = name
+	return nil
+}
+
+// Default はデフォルトのクラスターを返す．接続の設定に失敗していた場合はそのエラーを返す
+func (cs *Clusters) Default() (*Ctrl, error) {
+	cluster, ok := cs.byName[cs.defaultName]
+	if !ok {
+		return nil, fmt.Errorf("no cluster is configured")
+	}
+	if cluster.err != nil {
+		return nil, fmt.Errorf("cluster %q: %w", cluster.Name, cluster.err)
+	}
+	return cluster.Ctrl, nil
+}
+
+// StartCache は全てのクラスターのキャッシュを起動する．各クラスターの同期は独立していて，他のクラスターを待たない
+func (cs *Clusters) StartCache(stopCh <-chan struct{}) {
+	for _, cluster := range cs.clusters {
+		if cluster.Ctrl != nil {
+			cluster.Ctrl.StartCache(stopCh)
+		}
+	}
+}
+
+// HandleDefault はhandlerをデフォルトのクラスターで実行する
+func (cs *Clusters) HandleDefault(handler func(c *Ctrl) gin.HandlerFunc) gin.HandlerFunc {
+	return cs.handle(func(*gin.Context) string { return cs.defaultName }, handler)
+}
+
+// Handle はhandlerをパスの:clusterで指定されたクラスターで実行する
+func (cs *Clusters) Handle(handler func(c *Ctrl) gin.HandlerFunc) gin.HandlerFunc {
+	return cs.handle(func(ctx *gin.Context) string { return ctx.Param("cluster") }, handler)
+}
+
+// handlerはクラスターごとに作っておき，リクエストのたびにクラスターを選んで実行する．
+// キャッシュが同期していないクラスターへのリクエストは503を返す
+func (cs *Clusters) handle(clusterName func(ctx *gin.Context) string, handler func(c *Ctrl) gin.HandlerFunc) gin.HandlerFunc {
+	handlers := make(map[string][]gin.HandlerFunc, len(cs.clusters))
+	for _, cluster := range cs.clusters {
+		if cluster.Ctrl != nil {
+			handlers[cluster.Name] = []gin.HandlerFunc{cluster.Ctrl.RequireCacheSynced(), handler(cluster.Ctrl)}
+		}
+	}
+	return func(ctx *gin.Context) {
+		name := clusterName(ctx)
+		cluster, ok := cs.byName[name]
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("cluster %q not found", name),
+			})
+			return
+		}
+		ctx.Header("X-Cluster", cluster.Name)
+		if cluster.err != nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   cluster.err.Error(),
+				"cluster": cluster.Name,
+			})
+			return
+		}
+		for _, h := range handlers[cluster.Name] {
+			h(ctx)
+			if ctx.IsAborted() {
+				return
+			}
+		}
+	}
+}
+
+// GetReadiness はデフォルトのクラスターのキャッシュの同期が完了しているかを返す．readinessProbe用．
+// 他のクラスターに接続できなくてもデフォルトのクラスターが使えればreadyとする
+func (cs *Clusters) GetReadiness() gin.HandlerFunc {
+	readiness := make(map[string]gin.HandlerFunc, len(cs.clusters))
+	for _, cluster := range cs.clusters {
+		if cluster.Ctrl != nil {
+			readiness[cluster.Name] = cluster.Ctrl.GetReadiness()
+		}
+	}
+	return func(ctx *gin.Context) {
+		if _, err := cs.Default(); err != nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"ready":       false,
+				"last_synced": nil,
+				"error":       err.Error(),
+			})
+			return
+		}
+		readiness[cs.defaultName](ctx)
+	}
+}
+
+func (cs *Clusters) GetClusterList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("クラスター一覧")
+		res := model.ClusterListViewModel{
+			TotalCluster: len(cs.clusters),
+			Default:      cs.defaultName,
+			Clusters:     make([]model.ClusterViewModel, 0, len(cs.clusters)),
+		}
+		for _, cluster := range cs.clusters {
+			res.Clusters = append(res.Clusters, cs.clusterViewModel(cluster))
+		}
+		ctx.JSON(200, res)
+	}
+}
+
+func (cs *Clusters) GetClusterDetail() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("クラスター詳細")
+		name := ctx.Param("cluster")
+		cluster, ok := cs.byName[name]
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("cluster %q not found", name),
+			})
+			return
+		}
+		ctx.JSON(200, cs.clusterViewModel(cluster))
+	}
+}
+
+func (cs *Clusters) clusterViewModel(cluster *Cluster) model.ClusterViewModel {
+	res := model.ClusterViewModel{
+		Name:    cluster.Name,
+		Context: cluster.Context,
+		Server:  cluster.Server,
+		Default: cluster.Name == cs.defaultName,
+	}
+	if cluster.err != nil {
+		res.Error = cluster.err.Error()
+		return res
+	}
+	synced, lastSynced, err := cluster.Ctrl.Health()
+	res.Ready = synced
+	if synced {
+		res.LastSynced = &lastSynced
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -1,15 +1,22 @@
 package controller
 
 import (
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
 type Ctrl struct {
-	kubeClient *kubernetes.Clientset
+	kubeClient kubernetes.Interface
+	// Calico等のCRDの取得用
+	dynamicClient dynamic.Interface
+	// Pod, Node, Namespace, Network PolicyとpolicyのCRDはここから読む
+	cache *clusterCache
 }
 
-func NewController(kubeClient *kubernetes.Clientset) *Ctrl {
+func NewController(kubeClient kubernetes.Interface, dynamicClient dynamic.Interface) *Ctrl {
 	return &Ctrl{
-		kubeClient: kubeClient,
+		kubeClient:    kubeClient,
+		dynamicClient: dynamicClient,
+		cache:         newClusterCache(kubeClient, dynamicClient),
 	}
 }
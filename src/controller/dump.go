@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+)
+
+// snapshotに含めるCRD．同じリソースの複数バージョンは最初に取得できたものを使う
+var snapshotCustomResources = [][]schema.GroupVersionResource{
+	{calicoNetworkPolicyResource},
+	{calicoGlobalNetworkPolicyResource},
+	{calicoTierResource},
+	{ciliumNetworkPolicyResource},
+	{ciliumClusterwideNetworkPolicyResource},
+	{adminNetworkPolicyResource},
+	{baselineAdminNetworkPolicyResource},
+	gatewayResources,
+	httpRouteResources,
+}
+
+// CustomResourceListKinds は取得するCRDのリソースとList kindの対応を返す．snapshotモードのdynamic clientに登録する
+func CustomResourceListKinds() map[schema.GroupVersionResource]string {
+	res := map[schema.GroupVersionResource]string{
+		calicoNetworkPolicyResource:            "NetworkPolicyList",
+		calicoGlobalNetworkPolicyResource:      "GlobalNetworkPolicyList",
+		calicoTierResource:                     "TierList",
+		ciliumNetworkPolicyResource:            "CiliumNetworkPolicyList",
+		ciliumClusterwideNetworkPolicyResource: "CiliumClusterwideNetworkPolicyList",
+		adminNetworkPolicyResource:             "AdminNetworkPolicyList",
+		baselineAdminNetworkPolicyResource:     "BaselineAdminNetworkPolicyList",
+	}
+	for _, resource := range gatewayResources {
+		res[resource] = "GatewayList"
+	}
+	for _, resource := range httpRouteResources {
+		res[resource] = "HTTPRouteList"
+	}
+	return res
+}
+
+// Dump はAPIで使うリソースをsnapshotモードで読み込めるkind: ListのYAMLとしてリソースごとにdirへ書き出す
+func (c *Ctrl) Dump(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	lists := []struct {
+		name string
+		list func() (runtime.Object, error)
+	}{
+		{"nodes", func() (runtime.Object, error) {
+			return c.kubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		}},
+		{"namespaces", func() (runtime.Object, error) {
+			return c.kubeClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+		}},
+		{"pods", func() (runtime.Object, error) {
+			return c.kubeClient.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{})
+		}},
+		{"services", func() (runtime.Object, error) {
+			return c.kubeClient.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+		}},
+		{"endpointslices", func() (runtime.Object, error) {
+			return c.kubeClient.DiscoveryV1().EndpointSlices("").List(context.TODO(), metav1.ListOptions{})
+		}},
+		{"networkpolicies", func() (runtime.Object, error) {
+			return c.kubeClient.NetworkingV1().NetworkPolicies("").List(context.TODO(), metav1.ListOptions{})
+		}},
+		{"ingresses", func() (runtime.Object, error) {
+			return c.kubeClient.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+		}},
+	}
+	for _, l := range lists {
+		list, err := l.list()
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.name, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.name, err)
+		}
+		// List APIの結果はapiVersion, kindを持たないので補う
+		for _, item := range items {
+			gvks, _, err := scheme.Scheme.ObjectKinds(item)
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.name, err)
+			}
+			item.GetObjectKind().SetGroupVersionKind(gvks[0])
+		}
+		if err := writeSnapshotList(filepath.Join(dir, l.name+".yaml"), items); err != nil {
+			return err
+		}
+	}
+
+	for _, versions := range snapshotCustomResources {
+		items, err := c.listCustomResourceVersions(context.TODO(), versions)
+		if err != nil {
+			return fmt.Errorf("%s: %w", versions[0].GroupResource(), err)
+		}
+		objects := make([]runtime.Object, 0, len(items))
+		for i := range items {
+			objects = append(objects, &items[i])
+		}
+		if err := writeSnapshotList(filepath.Join(dir, versions[0].GroupResource().String()+".yaml"), objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSnapshotList(path string, items []runtime.Object) error {
+	for _, item := range items {
+		// 解析に不要で量が多いので除く
+		if accessor, err := meta.Accessor(item); err == nil {
+			accessor.SetManagedFields(nil)
+		}
+	}
+
+	b, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Printf("%s: %d件\n", path, len(items))
+	return os.WriteFile(path, b, 0o644)
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+const formatJSON = "json"
+
+// Acceptヘッダーのメディアタイプと書き出し形式の対応
+var graphMediaTypes = map[string]string{
+	"text/vnd.graphviz":                 model.GraphFormatDOT,
+	"text/vnd.mermaid":                  model.GraphFormatMermaid,
+	"application/graphml+xml":           model.GraphFormatGraphML,
+	"application/vnd.cytoscape.js+json": model.GraphFormatCytoscape,
+}
+
+// getGraphFormat は?format=またはAcceptヘッダーから応答の形式を決める．?format=が優先され，どちらの指定もない場合はjson
+func getGraphFormat(ctx *gin.Context) (string, error) {
+	if format := ctx.Query("format"); format != "" {
+		switch format {
+		case formatJSON, model.GraphFormatDOT, model.GraphFormatMermaid, model.GraphFormatGraphML, model.GraphFormatCytoscape:
+			return format, nil
+		default:
+			return "", fmt.Errorf("invalid format %q", format)
+		}
+	}
+
+	// ブラウザなどの対応していないメディアタイプはjsonとして扱う
+	for _, v := range strings.Split(ctx.GetHeader("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(v, ";")
+		if format, ok := graphMediaTypes[strings.TrimSpace(mediaType)]; ok {
+			return format, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// respondGraph はグラフを指定された形式で返す
+func respondGraph(ctx *gin.Context, format string, graph model.Graph) {
+	switch format {
+	case model.GraphFormatDOT:
+		ctx.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(model.FormatDOT(graph)))
+	case model.GraphFormatMermaid:
+		ctx.Data(http.StatusOK, "text/vnd.mermaid; charset=utf-8", []byte(model.FormatMermaid(graph)))
+	case model.GraphFormatGraphML:
+		b, err := model.FormatGraphML(graph)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.Data(http.StatusOK, "application/graphml+xml; charset=utf-8", b)
+	case model.GraphFormatCytoscape:
+		ctx.JSON(http.StatusOK, model.FormatCytoscape(graph))
+	}
+}
@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"net/http"
+	"time"
+)
+
+const (
+	// ingress-nginxのコントローラーのPodに付くラベル
+	defaultIngressControllerSelector = "app.kubernetes.io/name=ingress-nginx"
+	// Gatewayごとに作られるデータプレーンのPodに付くラベル
+	gatewayNameLabel = "gateway.networking.k8s.io/gateway-name"
+)
+
+// GetExposure はIngress, HTTPRouteからServiceを経てPodに至る経路の一覧を返す．
+// 各バックエンドについて，コントローラーのPodからtargetPortに通信できるかをpolicyから判定する．
+// ?ingress_controller=でIngressのコントローラー，?gateway_controller=でGatewayのPodをラベルセレクターで指定できる
+func (c *Ctrl) GetExposure() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("公開経路")
+		now := time.Now()
+
+		ingressSelector := defaultIngressControllerSelector
+		if v, ok := ctx.GetQuery("ingress_controller"); ok {
+			ingressSelector = v
+		}
+		ingressControllerSelector, err := labels.Parse(ingressSelector)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "ingress_controller: " + err.Error(),
+			})
+			return
+		}
+		// 指定がない場合はGatewayのラベルのみでPodを探す
+		gatewayControllerSelector := labels.Nothing()
+		if v := ctx.Query("gateway_controller"); v != "" {
+			gatewayControllerSelector, err = labels.Parse(v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "gateway_controller: " + err.Error(),
+				})
+				return
+			}
+		}
+		namespace := ctx.Query("namespace")
+
+		now2 := time.Now()
+		ingressList, err := c.cache.listIngresses(namespace)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		gateways, httpRoutes, gatewayWarnings, err := c.listGatewayResources(ctx.Request.Context())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// バックエンドは他のnamespaceのServiceを参照できるので全namespaceから取得する
+		serviceList, err := c.cache.listServices("")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		sliceList, err := c.cache.listEndpointSlices("", labels.Everything())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Pod一覧を取得
+		podList, err := c.cache.listPods()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Network Policy, Calicoのpolicy一覧を取得する
+		policySet, err := c.listPolicySet()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// namespaceSelectorで選択する必要があるので、namespace一覧を取得する
+		namespaceList, err := c.cache.listNamespaces()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		fmt.Printf("kube-api応答時間: %v\n", time.Since(now2)) // 計測用
+
+		serviceMap := make(map[string]v1.Service, len(serviceList))
+		for _, service := range serviceList {
+			serviceMap[service.Namespace+"/"+service.Name] = service
+		}
+		slicesMap := make(map[string][]discoveryv1.EndpointSlice)
+		for _, slice := range sliceList {
+			key := slice.Namespace + "/" + slice.Labels[discoveryv1.LabelServiceName]
+			slicesMap[key] = append(slicesMap[key], slice)
+		}
+		podMap := make(map[string]v1.Pod, len(podList))
+		for _, pod := range podList {
+			podMap[pod.Namespace+"/"+pod.Name] = pod
+		}
+		gatewayMap := make(map[string]model.Gateway, len(gateways))
+		for _, gateway := range gateways {
+			gatewayMap[gateway.Namespace+"/"+gateway.Name] = gateway
+		}
+
+		// 経路を集め，経路ごとに通信元となるコントローラーのPodを決める
+		routes := make([]model.ExposureRoute, 0)
+		controllers := make([][]v1.Pod, 0)
+		ingressControllers := selectControllerPods(podList, func(pod v1.Pod) bool {
+			return ingressControllerSelector.Matches(labels.Set(pod.Labels))
+		})
+		for _, ingress := range ingressList {
+			for _, route := range model.IngressRoutes(ingress) {
+				routes = append(routes, route)
+				controllers = append(controllers, ingressControllers)
+			}
+		}
+		for _, httpRoute := range httpRoutes {
+			if namespace != "" && httpRoute.Namespace != namespace {
+				continue
+			}
+			for _, route := range model.HTTPRouteRoutes(httpRoute, gatewayMap) {
+				routes = append(routes, route)
+				controllers = append(controllers, selectControllerPods(podList, func(pod v1.Pod) bool {
+					if gatewayControllerSelector.Matches(labels.Set(pod.Labels)) {
+						return true
+					}
+					for _, gateway := range route.Gateways {
+						if pod.Namespace+"/"+pod.Labels[gatewayNameLabel] == gateway {
+							return true
+						}
+					}
+					return false
+				}))
+			}
+		}
+
+		engine := policy.NewEngineWithPolicySet(nil, namespaceList, policySet)
+		accesses := make(map[string]policy.Access)
+		totalBlocked := 0
+		for i := range routes {
+			route := &routes[i]
+			route.Controllers = make([]model.PodRef, 0, len(controllers[i]))
+			for _, pod := range controllers[i] {
+				route.Controllers = append(route.Controllers, model.PodRefViewModel(pod))
+			}
+
+			serviceKey := route.Service.Namespace + "/" + route.Service.Name
+			service, ok := serviceMap[serviceKey]
+			route.Service.Found = ok
+			if !ok {
+				route.Backends = []model.ExposureBackend{}
+				continue
+			}
+			route.Backends = model.ExposureBackends(service, route.Service.Port, slicesMap[serviceKey], podMap)
+
+			for j := range route.Backends {
+				backend := &route.Backends[j]
+				backendPod, ok := podMap[backend.Namespace+"/"+backend.Name]
+				if !ok {
+					// Podに紐づかないエンドポイントは評価できない
+					continue
+				}
+				backend.Policies = model.AppliedPolicyViewModel(engine.IngressPolicies(backendPod))
+				for _, controllerPod := range controllers[i] {
+					// 同じコントローラーとPodの組は一度だけ評価する
+					key := controllerPod.Namespace + "/" + controllerPod.Name + ">" + backendPod.Namespace + "/" + backendPod.Name
+					access, ok := accesses[key]
+					if !ok {
+						access, err = engine.Check(controllerPod, backendPod)
+						if err != nil {
+							ctx.JSON(http.StatusInternalServerError, gin.H{
+								"error": err.Error(),
+							})
+							return
+						}
+						accesses[key] = access
+					}
+					if !access.AllowsPort(backend.Protocol, backend.TargetPort) {
+						backend.BlockedFrom = append(backend.BlockedFrom, model.PodRefViewModel(controllerPod))
+						route.Blocked = true
+					}
+				}
+			}
+			if route.Blocked {
+				totalBlocked++
+			}
+		}
+
+		res := model.ExposureViewModel{
+			TotalRoute:   len(routes),
+			Routes:       routes,
+			TotalBlocked: totalBlocked,
+			Warnings:     model.WarningViewModel(append(gatewayWarnings, policySet.Warnings...)),
+		}
+
+		ctx.JSON(http.StatusOK, res)
+		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
+	}
+}
+
+// 条件に合うPodのうちpolicyで評価できる状態のもの
+func selectControllerPods(pods []v1.Pod, match func(pod v1.Pod) bool) []v1.Pod {
+	res := make([]v1.Pod, 0)
+	for _, pod := range pods {
+		if match(pod) && policy.ClassifyPod(pod).IsApplicable() {
+			res = append(res, pod)
+		}
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Gateway APIはv1がないクラスターではv1beta1を使う
+var (
+	gatewayResources = []schema.GroupVersionResource{
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"},
+		{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "gateways"},
+	}
+	httpRouteResources = []schema.GroupVersionResource{
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"},
+		{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "httproutes"},
+	}
+)
+
+// Gateway, HTTPRouteを取得する．Gateway APIのCRDがないクラスターでは空を返す．
+// 変換できないオブジェクトは警告を残して除外する
+func (c *Ctrl) listGatewayResources(ctx context.Context) ([]model.Gateway, []model.HTTPRoute, []policy.Warning, error) {
+	warnings := make([]policy.Warning, 0)
+	items, err := c.listCustomResourceVersions(ctx, gatewayResources)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	gateways := make([]model.Gateway, 0, len(items))
+	for _, item := range items {
+		g, err := model.NewGateway(item)
+		if err != nil {
+			warnings = append(warnings, policy.NewObjectWarning(item, err))
+			continue
+		}
+		gateways = append(gateways, g)
+	}
+
+	items, err = c.listCustomResourceVersions(ctx, httpRouteResources)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	routes := make([]model.HTTPRoute, 0, len(items))
+	for _, item := range items {
+		r, err := model.NewHTTPRoute(item)
+		if err != nil {
+			warnings = append(warnings, policy.NewObjectWarning(item, err))
+			continue
+		}
+		routes = append(routes, r)
+	}
+	return gateways, routes, warnings, nil
+}
+
+// 同じリソースのバージョンを順に試し，最初に取得できたものを返す
+func (c *Ctrl) listCustomResourceVersions(ctx context.Context, resources []schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	for _, resource := range resources {
+		items, err := c.listCustomResource(ctx, resource)
+		if err != nil {
+			return nil, err
+		}
+		if items != nil {
+			return items, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListGatewayResources(t *testing.T) {
+	c := newTestController(t)
+	// fakeのdynamic clientはkindからGatewayのresourceを正しく推測できないので，resourceを指定して作る
+	objects := []struct {
+		gateway bool
+		name    string
+		spec    map[string]interface{}
+	}{
+		{gateway: true, name: "web", spec: map[string]interface{}{
+			"gatewayClassName": "nginx",
+			"listeners":        []interface{}{map[string]interface{}{"name": "http", "port": int64(80), "protocol": "HTTP"}},
+		}},
+		// portが数値でないので変換できない
+		{gateway: true, name: "broken", spec: map[string]interface{}{
+			"listeners": []interface{}{map[string]interface{}{"name": "http", "port": "http"}},
+		}},
+		{name: "web", spec: map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{"name": "web"}},
+		}},
+		// hostnamesが配列でないので変換できない
+		{name: "broken", spec: map[string]interface{}{
+			"hostnames": "example.com",
+		}},
+	}
+	for _, o := range objects {
+		resource, kind := httpRouteResources[0], "HTTPRoute"
+		if o.gateway {
+			resource, kind = gatewayResources[0], "Gateway"
+		}
+		obj := newTestObject(resource.GroupVersion().String(), kind, "default", o.name, o.spec)
+		if _, err := c.dynamicClient.Resource(resource).Namespace("default").Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gateways, routes, warnings, err := c.listGatewayResources(context.Background())
+	if err != nil {
+		t.Fatalf("listGatewayResources() error = %v", err)
+	}
+	if len(gateways) != 1 || gateways[0].Name != "web" {
+		t.Errorf("listGatewayResources() gateways = %+v", gateways)
+	}
+	if len(routes) != 1 || routes[0].Name != "web" {
+		t.Errorf("listGatewayResources() routes = %+v", routes)
+	}
+	if got, want := warningNames(warnings), []string{"Gateway/broken", "HTTPRoute/broken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listGatewayResources() warnings = %v, want %v", got, want)
+	}
+}
@@ -1,11 +1,10 @@
 package controller
 
 import (
-	"context"
 	"fmt"
 	"github.com/asuyasuya/k8s-vis-backend/src/model"
 	"github.com/gin-gonic/gin"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"net/http"
 	"time"
 )
@@ -15,7 +14,13 @@ func (c *Ctrl) GetNodeDetail() gin.HandlerFunc {
 		fmt.Println("ノード詳細")
 		now := time.Now()
 		nodeName := ctx.Param("name")
-		node, err := c.kubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+		node, err := c.cache.getNode(nodeName)
+		if apierrors.IsNotFound(err) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -26,9 +31,12 @@ func (c *Ctrl) GetNodeDetail() gin.HandlerFunc {
 
 		res := model.NodeDetailViewModel{
 			Name:    node.Name,
-			Ip:      node.Status.Addresses[0].Address,
 			PodCidr: node.Spec.PodCIDR,
 		}
+		// snapshotのノードはstatusを持たない場合がある
+		if len(node.Status.Addresses) != 0 {
+			res.Ip = node.Status.Addresses[0].Address
+		}
 
 		ctx.JSON(200, res)
 		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
@@ -1,11 +1,9 @@
 package controller
 
 import (
-	"context"
 	"fmt"
 	"github.com/asuyasuya/k8s-vis-backend/src/model"
 	"github.com/gin-gonic/gin"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/http"
 	"time"
 )
@@ -14,14 +12,23 @@ func (c *Ctrl) GetNodeList() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		fmt.Println("ノード一覧")
 		now := time.Now() // 計測用
-		nodeList, err := c.kubeClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+
+		format, err := getGraphFormat(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		nodeList, err := c.cache.listNodes()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
 			return
 		}
-		podList, err := c.kubeClient.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{})
+		podList, err := c.cache.listPods()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -30,19 +37,22 @@ func (c *Ctrl) GetNodeList() gin.HandlerFunc {
 		}
 		fmt.Printf("kube-api応答時間: %v\n", time.Since(now)) // 計測用
 
-		nodeNamePodsMap := make(map[string][]model.PodViewModel, len(nodeList.Items))
-		for _, pod := range podList.Items {
+		nodeNamePodsMap := make(map[string][]model.PodViewModel, len(nodeList))
+		// snapshotではノードがなくPodだけある場合がある
+		podCapacity := 0
+		if len(nodeList) > 0 {
+			podCapacity = len(podList) / len(nodeList)
+		}
+		for _, pod := range podList {
 			nodeName := pod.Spec.NodeName
 			if _, ok := nodeNamePodsMap[nodeName]; !ok {
-				nodeNamePodsMap[nodeName] = make([]model.PodViewModel, 0, len(podList.Items)/len(nodeList.Items))
+				nodeNamePodsMap[nodeName] = make([]model.PodViewModel, 0, podCapacity)
 			}
-			nodeNamePodsMap[nodeName] = append(nodeNamePodsMap[nodeName], model.PodViewModel{
-				Name: pod.Name,
-			})
+			nodeNamePodsMap[nodeName] = append(nodeNamePodsMap[nodeName], model.Cast2PodViewModel(pod))
 		}
 
-		nodes := make([]model.NodeViewModel, 0, len(nodeList.Items))
-		for _, node := range nodeList.Items {
+		nodes := make([]model.NodeViewModel, 0, len(nodeList))
+		for _, node := range nodeList {
 			nodes = append(nodes, model.NodeViewModel{
 				Name:     node.Name,
 				TotalPod: len(nodeNamePodsMap[node.Name]),
@@ -50,12 +60,28 @@ func (c *Ctrl) GetNodeList() gin.HandlerFunc {
 			})
 		}
 
+		// スケジュールされていないPodはNodeNameが空
+		unscheduled := nodeNamePodsMap[""]
+		if unscheduled == nil {
+			unscheduled = []model.PodViewModel{}
+		}
+
+		_, lastSynced := c.cache.status()
 		res := model.NodeListViewModel{
 			TotalNode: len(nodes),
 			Nodes:     nodes,
+			Unscheduled: model.UnscheduledViewModel{
+				TotalPod: len(unscheduled),
+				Pods:     unscheduled,
+			},
+			LastSynced: lastSynced,
 		}
 
-		ctx.JSON(http.StatusOK, res)
+		if format != formatJSON {
+			respondGraph(ctx, format, model.NodeListGraph(res))
+		} else {
+			ctx.JSON(http.StatusOK, res)
+		}
 		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
 	}
 }
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetNodeListUnscheduled(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Spec:       v1.PodSpec{NodeName: "node-1"},
+			Status:     v1.PodStatus{Phase: v1.PodRunning, PodIP: "10.0.0.1"},
+		},
+		// スケジュールされていない
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pending"},
+			Status:     v1.PodStatus{Phase: v1.PodPending},
+		},
+	)
+	c := NewController(kubeClient, nil)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.StartCache(stopCh)
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		synced, _ := c.cache.status()
+		return synced, nil
+	})
+	if err != nil {
+		t.Fatalf("cache did not sync: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/nodes", c.GetNodeList())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nodes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /nodes = %d, %s", w.Code, w.Body.String())
+	}
+
+	var res model.NodeListViewModel
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Nodes) != 1 || res.Nodes[0].TotalPod != 1 || res.Nodes[0].Pods[0].Name != "web" {
+		t.Errorf("nodes = %+v", res.Nodes)
+	}
+	if res.Unscheduled.TotalPod != 1 || res.Unscheduled.Pods[0].Name != "pending" || res.Unscheduled.Pods[0].State != "pending" {
+		t.Errorf("unscheduled = %+v", res.Unscheduled)
+	}
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+func (c *Ctrl) GetPolicyLint() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("Network Policyの検査")
+		now := time.Now()
+
+		// fail_onで指定した重要度以上の指摘があれば422を返す(デプロイのゲート用)
+		failOn := ctx.Query("fail_on")
+		if failOn != "" && failOn != string(policy.SeverityError) && failOn != string(policy.SeverityWarning) && failOn != string(policy.SeverityInfo) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid fail_on " + failOn,
+			})
+			return
+		}
+
+		now2 := time.Now()
+		// Pod一覧を取得
+		podList, err := c.cache.listPods()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Network Policy一覧を取得する
+		policyList, err := c.cache.listNetworkPolicies()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// namespaceSelectorで選択する必要があるので、namespace一覧を取得する
+		namespaceList, err := c.cache.listNamespaces()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		fmt.Printf("kube-api応答時間: %v\n", time.Since(now2)) // 計測用
+
+		engine := policy.NewEngine(podList, namespaceList, policyList)
+		res := model.PolicyLint(engine.Lint())
+
+		status := http.StatusOK
+		if isLintFailed(res, failOn) {
+			status = http.StatusUnprocessableEntity
+		}
+
+		ctx.JSON(status, res)
+		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
+	}
+}
+
+func isLintFailed(res model.PolicyLintViewModel, failOn string) bool {
+	switch policy.Severity(failOn) {
+	case policy.SeverityError:
+		return res.Errors > 0
+	case policy.SeverityWarning:
+		return res.Errors+res.Warnings > 0
+	case policy.SeverityInfo:
+		return res.TotalFinding > 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// informerで監視するpolicyのCRD
+var policyCustomResources = []schema.GroupVersionResource{
+	calicoNetworkPolicyResource,
+	calicoGlobalNetworkPolicyResource,
+	calicoTierResource,
+	ciliumNetworkPolicyResource,
+	ciliumClusterwideNetworkPolicyResource,
+	adminNetworkPolicyResource,
+	baselineAdminNetworkPolicyResource,
+}
+
+// Network PolicyとAdminNetworkPolicy, Calico, Ciliumのpolicyをまとめてキャッシュから取得する．
+// CRDのオブジェクトのうち変換できないものはPolicySet.Warningsに入れ，残りのpolicyで評価できるようにする
+func (c *Ctrl) listPolicySet() (policy.PolicySet, error) {
+	policyList, err := c.cache.listNetworkPolicies()
+	if err != nil {
+		return policy.PolicySet{}, err
+	}
+	calicoPolicies, calicoTiers, calicoWarnings, err := c.listCalicoPolicies()
+	if err != nil {
+		return policy.PolicySet{}, err
+	}
+	ciliumPolicies, ciliumWarnings, err := c.listCiliumPolicies()
+	if err != nil {
+		return policy.PolicySet{}, err
+	}
+	adminPolicies, adminWarnings, err := c.listAdminNetworkPolicies(adminNetworkPolicyResource)
+	if err != nil {
+		return policy.PolicySet{}, err
+	}
+	baselinePolicies, baselineWarnings, err := c.listAdminNetworkPolicies(baselineAdminNetworkPolicyResource)
+	if err != nil {
+		return policy.PolicySet{}, err
+	}
+
+	warnings := make([]policy.Warning, 0)
+	for _, v := range [][]policy.Warning{calicoWarnings, ciliumWarnings, adminWarnings, baselineWarnings} {
+		warnings = append(warnings, v...)
+	}
+	return policy.PolicySet{
+		NetworkPolicies:              policyList,
+		CalicoPolicies:               calicoPolicies,
+		CalicoTiers:                  calicoTiers,
+		CiliumPolicies:               ciliumPolicies,
+		AdminNetworkPolicies:         adminPolicies,
+		BaselineAdminNetworkPolicies: baselinePolicies,
+		Warnings:                     warnings,
+	}, nil
+}
+
+// CRDのリソースを全namespaceからAPIサーバーに問い合わせて取得する．CRDがインストールされていないクラスターでは空を返す
+func (c *Ctrl) listCustomResource(ctx context.Context, resource schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	if c.dynamicClient == nil {
+		return nil, nil
+	}
+
+	list, err := c.dynamicClient.Resource(resource).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
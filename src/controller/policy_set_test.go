@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestObject(apiVersion string, kind string, namespace string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"spec":       spec,
+	}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// fakeのclientで作ったControllerのキャッシュを同期させる
+func newTestController(t *testing.T, objs ...runtime.Object) *Ctrl {
+	t.Helper()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), CustomResourceListKinds(), objs...)
+	c := NewController(fake.NewSimpleClientset(), dynamicClient)
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	c.StartCache(stopCh)
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		synced, _ := c.cache.status()
+		return synced, nil
+	})
+	if err != nil {
+		t.Fatalf("cache did not sync: %v", err)
+	}
+	return c
+}
+
+func warningNames(warnings []policy.Warning) []string {
+	res := make([]string, 0, len(warnings))
+	for _, w := range warnings {
+		res = append(res, w.Kind+"/"+w.PolicyName)
+	}
+	return res
+}
+
+func TestListCalicoPolicies(t *testing.T) {
+	c := newTestController(t,
+		newTestObject("crd.projectcalico.org/v1", "NetworkPolicy", "default", "allow-web", map[string]interface{}{
+			"tier":     "security",
+			"order":    int64(10),
+			"selector": "app == 'web'",
+			"ingress":  []interface{}{map[string]interface{}{"action": "Allow"}},
+		}),
+		// orderが数値でないので変換できない
+		newTestObject("crd.projectcalico.org/v1", "NetworkPolicy", "default", "broken", map[string]interface{}{
+			"order": "first",
+		}),
+		newTestObject("crd.projectcalico.org/v1", "GlobalNetworkPolicy", "", "deny-all", map[string]interface{}{
+			"selector": "all()",
+			"types":    []interface{}{"Ingress"},
+		}),
+		newTestObject("crd.projectcalico.org/v1", "Tier", "", "security", map[string]interface{}{
+			"order": int64(100),
+		}),
+	)
+
+	policies, tiers, warnings, err := c.listCalicoPolicies()
+	if err != nil {
+		t.Fatalf("listCalicoPolicies() error = %v", err)
+	}
+
+	if len(policies) != 2 {
+		t.Fatalf("listCalicoPolicies() policies = %+v, want 2", policies)
+	}
+	if p := policies[0]; p.Name != "allow-web" || p.Namespace != "default" || p.Global || p.Spec.Tier != "security" || p.Spec.Order == nil || *p.Spec.Order != 10 {
+		t.Errorf("policies[0] = %+v", p)
+	}
+	if p := policies[1]; p.Name != "deny-all" || !p.Global {
+		t.Errorf("policies[1] = %+v", p)
+	}
+
+	if len(tiers) != 1 || tiers[0].Name != "security" || tiers[0].Order == nil || *tiers[0].Order != 100 {
+		t.Errorf("listCalicoPolicies() tiers = %+v", tiers)
+	}
+
+	if got, want := warningNames(warnings), []string{"NetworkPolicy/broken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listCalicoPolicies() warnings = %v, want %v", got, want)
+	}
+	if warnings[0].Code != policy.WarningCodeInvalidObject || warnings[0].Namespace != "default" {
+		t.Errorf("warnings[0] = %+v", warnings[0])
+	}
+}
+
+func TestListCiliumPolicies(t *testing.T) {
+	c := newTestController(t,
+		newTestObject("cilium.io/v2", "CiliumNetworkPolicy", "default", "web", map[string]interface{}{
+			"endpointSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+		}),
+		newTestObject("cilium.io/v2", "CiliumClusterwideNetworkPolicy", "", "cluster", map[string]interface{}{
+			"endpointSelector": map[string]interface{}{},
+		}),
+		// endpointSelectorがオブジェクトでないので変換できない
+		newTestObject("cilium.io/v2", "CiliumNetworkPolicy", "default", "broken", map[string]interface{}{
+			"endpointSelector": "app=web",
+		}),
+	)
+
+	policies, warnings, err := c.listCiliumPolicies()
+	if err != nil {
+		t.Fatalf("listCiliumPolicies() error = %v", err)
+	}
+
+	if len(policies) != 2 {
+		t.Fatalf("listCiliumPolicies() policies = %+v, want 2", policies)
+	}
+	if p := policies[0]; p.Name != "web" || p.Clusterwide || len(p.Specs) != 1 {
+		t.Errorf("policies[0] = %+v", p)
+	}
+	if p := policies[1]; p.Name != "cluster" || !p.Clusterwide {
+		t.Errorf("policies[1] = %+v", p)
+	}
+
+	if got, want := warningNames(warnings), []string{"CiliumNetworkPolicy/broken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listCiliumPolicies() warnings = %v, want %v", got, want)
+	}
+}
+
+func TestListAdminNetworkPolicies(t *testing.T) {
+	c := newTestController(t,
+		newTestObject("policy.networking.k8s.io/v1alpha1", "AdminNetworkPolicy", "", "deny-db", map[string]interface{}{
+			"priority": int64(10),
+			"subject":  map[string]interface{}{"namespaces": map[string]interface{}{}},
+		}),
+		// priorityが数値でないので変換できない
+		newTestObject("policy.networking.k8s.io/v1alpha1", "AdminNetworkPolicy", "", "broken", map[string]interface{}{
+			"priority": "high",
+		}),
+		newTestObject("policy.networking.k8s.io/v1alpha1", "BaselineAdminNetworkPolicy", "", "default", map[string]interface{}{
+			"subject": map[string]interface{}{"namespaces": map[string]interface{}{}},
+		}),
+	)
+
+	tests := []struct {
+		name         string
+		resource     func() ([]policy.AdminNetworkPolicy, []policy.Warning, error)
+		wantNames    []string
+		wantWarnings []string
+	}{
+		{
+			name: "AdminNetworkPolicy",
+			resource: func() ([]policy.AdminNetworkPolicy, []policy.Warning, error) {
+				return c.listAdminNetworkPolicies(adminNetworkPolicyResource)
+			},
+			wantNames:    []string{"deny-db"},
+			wantWarnings: []string{"AdminNetworkPolicy/broken"},
+		},
+		{
+			name: "BaselineAdminNetworkPolicy",
+			resource: func() ([]policy.AdminNetworkPolicy, []policy.Warning, error) {
+				return c.listAdminNetworkPolicies(baselineAdminNetworkPolicyResource)
+			},
+			wantNames:    []string{"default"},
+			wantWarnings: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, warnings, err := tt.resource()
+			if err != nil {
+				t.Fatalf("listAdminNetworkPolicies() error = %v", err)
+			}
+			names := make([]string, 0, len(policies))
+			for _, p := range policies {
+				names = append(names, p.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("listAdminNetworkPolicies() = %v, want %v", names, tt.wantNames)
+			}
+			if got := warningNames(warnings); !reflect.DeepEqual(got, tt.wantWarnings) {
+				t.Errorf("listAdminNetworkPolicies() warnings = %v, want %v", got, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestListPolicySet(t *testing.T) {
+	c := newTestController(t,
+		newTestObject("crd.projectcalico.org/v1", "NetworkPolicy", "default", "calico", map[string]interface{}{}),
+		newTestObject("cilium.io/v2", "CiliumNetworkPolicy", "default", "cilium", map[string]interface{}{}),
+		newTestObject("cilium.io/v2", "CiliumNetworkPolicy", "default", "broken", map[string]interface{}{
+			"endpointSelector": "app=web",
+		}),
+		newTestObject("policy.networking.k8s.io/v1alpha1", "AdminNetworkPolicy", "", "anp", map[string]interface{}{}),
+	)
+
+	policySet, err := c.listPolicySet()
+	if err != nil {
+		t.Fatalf("listPolicySet() error = %v", err)
+	}
+	if len(policySet.CalicoPolicies) != 1 || len(policySet.CiliumPolicies) != 1 || len(policySet.AdminNetworkPolicies) != 1 || len(policySet.BaselineAdminNetworkPolicies) != 0 {
+		t.Errorf("listPolicySet() = %+v", policySet)
+	}
+	if got, want := warningNames(policySet.Warnings), []string{"CiliumNetworkPolicy/broken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listPolicySet() warnings = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c *Ctrl) GetReachability() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("通信可否")
+		now := time.Now()
+
+		fromNamespace, fromName, err := parsePodRef(ctx.Query("from"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "from: " + err.Error(),
+			})
+			return
+		}
+		toNamespace, toName, err := parsePodRef(ctx.Query("to"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "to: " + err.Error(),
+			})
+			return
+		}
+		protocol, port, err := parseProtocolPort(ctx.Query("protocol"), ctx.Query("port"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		now2 := time.Now()
+		fromPod, err := c.findPod(fromNamespace, fromName)
+		if err != nil {
+			respondPodError(ctx, err)
+			return
+		}
+		toPod, err := c.findPod(toNamespace, toName)
+		if err != nil {
+			respondPodError(ctx, err)
+			return
+		}
+
+		// Network Policy, Calicoのpolicy一覧を取得する
+		policySet, err := c.listPolicySet()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// namespaceSelectorで選択する必要があるので、namespace一覧を取得する
+		namespaceList, err := c.cache.listNamespaces()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		fmt.Printf("kube-api応答時間: %v\n", time.Since(now2)) // 計測用
+
+		engine := policy.NewEngineWithPolicySet(nil, namespaceList, policySet)
+		access, err := engine.Check(fromPod, toPod)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		res := model.Reachability(fromPod, toPod, protocol, port, access)
+
+		ctx.JSON(http.StatusOK, res)
+		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
+	}
+}
+
+// "namespace/name"形式のPod指定を分解する．namespaceを省略した場合は全namespaceから名前で探す
+func parsePodRef(ref string) (string, string, error) {
+	if ref == "" {
+		return "", "", fmt.Errorf("pod is required")
+	}
+
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found {
+		return "", ref, nil
+	}
+	if namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid pod %q, expected namespace/name", ref)
+	}
+	return namespace, name, nil
+}
+
+// portだけ指定された場合のprotocolはTCPとして扱う．どちらも省略した場合はいずれかの通信が許可されているかを判定する
+func parseProtocolPort(protocol string, port string) (string, int, error) {
+	protocol = strings.ToUpper(protocol)
+	switch protocol {
+	case "":
+		if port != "" {
+			protocol = "TCP"
+		} else {
+			protocol = "any"
+		}
+	case "TCP", "UDP", "SCTP":
+	default:
+		return "", 0, fmt.Errorf("invalid protocol %q", protocol)
+	}
+
+	if port == "" {
+		return protocol, 0, nil
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber < 1 || portNumber > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", port)
+	}
+	return protocol, portNumber, nil
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func (c *Ctrl) GetReachabilityMatrix() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("通信可否一覧")
+		now := time.Now()
+
+		encoding := ctx.DefaultQuery("encoding", model.MatrixEncodingSparse)
+		if encoding != model.MatrixEncodingSparse && encoding != model.MatrixEncodingBitset {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid encoding " + encoding,
+			})
+			return
+		}
+		// encodingはjsonの場合のみ使う
+		format, err := getGraphFormat(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		now2 := time.Now()
+		// Pod一覧を取得
+		podList, err := c.cache.listPods()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Network Policy, Calicoのpolicy一覧を取得する
+		policySet, err := c.listPolicySet()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// namespaceSelectorで選択する必要があるので、namespace一覧を取得する
+		namespaceList, err := c.cache.listNamespaces()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		fmt.Printf("kube-api応答時間: %v\n", time.Since(now2)) // 計測用
+
+		pods := filterPodsByNamespaces(podList, ctx.Query("namespace"))
+
+		engine := policy.NewEngineWithPolicySet(podList, namespaceList, policySet)
+		matrix, err := engine.Matrix(pods)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if format != formatJSON {
+			respondGraph(ctx, format, model.ReachabilityMatrixGraph(matrix))
+		} else {
+			ctx.JSON(http.StatusOK, model.ReachabilityMatrix(matrix, encoding))
+		}
+		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
+	}
+}
+
+// カンマ区切りのnamespaceに属するPodのみに絞る．空の場合は全て
+func filterPodsByNamespaces(pods []v1.Pod, namespaces string) []v1.Pod {
+	if namespaces == "" {
+		return pods
+	}
+
+	namespaceSet := make(map[string]struct{})
+	for _, ns := range strings.Split(namespaces, ",") {
+		namespaceSet[strings.TrimSpace(ns)] = struct{}{}
+	}
+
+	res := make([]v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if _, ok := namespaceSet[pod.Namespace]; ok {
+			res = append(res, pod)
+		}
+	}
+	return res
+}
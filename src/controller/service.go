@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"net/http"
+	"time"
+)
+
+func (c *Ctrl) GetServiceList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("Service一覧")
+		now := time.Now()
+
+		namespace := ctx.Query("namespace")
+		serviceList, err := c.cache.listServices(namespace)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		sliceList, err := c.cache.listEndpointSlices(namespace, labels.Everything())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		// EndpointSliceはkubernetes.io/service-nameラベルでServiceに紐づく
+		slicesMap := make(map[string][]discoveryv1.EndpointSlice)
+		for _, slice := range sliceList {
+			key := slice.Namespace + "/" + slice.Labels[discoveryv1.LabelServiceName]
+			slicesMap[key] = append(slicesMap[key], slice)
+		}
+
+		services := make([]model.ServiceViewModel, 0, len(serviceList))
+		for _, service := range serviceList {
+			services = append(services, model.Service(service, slicesMap[service.Namespace+"/"+service.Name]))
+		}
+
+		res := model.ServiceListViewModel{
+			TotalService: len(services),
+			Services:     services,
+		}
+
+		ctx.JSON(http.StatusOK, res)
+		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
+	}
+}
+
+// GetServiceDetail はServiceのバックエンドを返す．?client=namespace/nameでPodを指定すると各バックエンドへの通信可否も返す
+func (c *Ctrl) GetServiceDetail() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("Service詳細")
+		now := time.Now()
+
+		namespace, name := ctx.Param("namespace"), ctx.Param("name")
+		var clientNamespace, clientName string
+		if client := ctx.Query("client"); client != "" {
+			var err error
+			clientNamespace, clientName, err = parsePodRef(client)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "client: " + err.Error(),
+				})
+				return
+			}
+		}
+
+		now2 := time.Now()
+		service, err := c.cache.getService(namespace, name)
+		if apierrors.IsNotFound(err) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("service %q not found in namespace %q", name, namespace),
+			})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		sliceList, err := c.cache.listEndpointSlices(namespace, labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: name}))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Pod一覧を取得
+		podList, err := c.cache.listPods()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		podMap := make(map[string]v1.Pod, len(podList))
+		for _, pod := range podList {
+			podMap[pod.Namespace+"/"+pod.Name] = pod
+		}
+
+		var clientPod *v1.Pod
+		accesses := make(map[string]policy.Access)
+		if clientName != "" {
+			pod, err := c.findPod(clientNamespace, clientName)
+			if err != nil {
+				respondPodError(ctx, err)
+				return
+			}
+			clientPod = &pod
+
+			// Network Policy, Calicoのpolicy一覧を取得する
+			policySet, err := c.listPolicySet()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+
+			// namespaceSelectorで選択する必要があるので、namespace一覧を取得する
+			namespaceList, err := c.cache.listNamespaces()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			fmt.Printf("kube-api応答時間: %v\n", time.Since(now2)) // 計測用
+
+			// clientからServiceのバックエンドの各Podへの通信可否を評価する
+			engine := policy.NewEngineWithPolicySet(nil, namespaceList, policySet)
+			for _, slice := range sliceList {
+				for _, endpoint := range slice.Endpoints {
+					if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+						continue
+					}
+					key := endpoint.TargetRef.Namespace + "/" + endpoint.TargetRef.Name
+					backendPod, ok := podMap[key]
+					if !ok {
+						continue
+					}
+					if _, ok := accesses[key]; ok {
+						continue
+					}
+					access, err := engine.Check(pod, backendPod)
+					if err != nil {
+						ctx.JSON(http.StatusInternalServerError, gin.H{
+							"error": err.Error(),
+						})
+						return
+					}
+					accesses[key] = access
+				}
+			}
+		}
+
+		res := model.ServiceDetail(service, sliceList, podMap, clientPod, accesses)
+
+		ctx.JSON(http.StatusOK, res)
+		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
+	}
+}
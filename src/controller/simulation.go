@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"github.com/gin-gonic/gin"
+	"io"
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"net/http"
+	"time"
+)
+
+// シミュレーションできるpolicyのapiVersion．CalicoのNetworkPolicy等の同名のkindは受け付けない
+const networkPolicyAPIVersion = "networking.k8s.io/v1"
+
+// simulationDocument はPOST /api/simulateのbodyの1ドキュメント．
+// kindがNetworkPolicy(List)であれば追加，置換するpolicyとして扱い，kindがなければapply, deleteを読む
+type simulationDocument struct {
+	metav1.TypeMeta `json:",inline"`
+	Apply           []json.RawMessage `json:"apply"`
+	Delete          []struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"delete"`
+}
+
+func (c *Ctrl) Simulate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("Network Policy変更のシミュレーション")
+		now := time.Now()
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		overlay, err := parseOverlay(body)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		now2 := time.Now()
+		// Pod一覧を取得
+		podList, err := c.cache.listPods()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Network PolicyとCalico等のpolicyの一覧を取得する
+		policySet, err := c.listPolicySet()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// namespaceSelectorで選択する必要があるので、namespace一覧を取得する
+		namespaceList, err := c.cache.listNamespaces()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		fmt.Printf("kube-api応答時間: %v\n", time.Since(now2)) // 計測用
+
+		result, err := policy.Simulate(podList, namespaceList, policySet, overlay)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		res := model.Simulation(result)
+
+		ctx.JSON(http.StatusOK, res)
+		fmt.Printf("全体処理時間: %v\n", time.Since(now)) // 計測用
+	}
+}
+
+// YAMLまたはJSONの(複数ドキュメントの)bodyをOverlayに直す
+func parseOverlay(body []byte) (policy.Overlay, error) {
+	var overlay policy.Overlay
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(body), 4096)
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return policy.Overlay{}, err
+		}
+		if len(raw.Raw) == 0 || string(raw.Raw) == "null" {
+			continue
+		}
+
+		var doc simulationDocument
+		if err := json.Unmarshal(raw.Raw, &doc); err != nil {
+			return policy.Overlay{}, err
+		}
+
+		switch doc.Kind {
+		case "":
+			for i, item := range doc.Apply {
+				// apply, NetworkPolicyListの要素はapiVersion, kindを省略できる
+				networkPolicy, err := decodeNetworkPolicy(item, true)
+				if err != nil {
+					return policy.Overlay{}, fmt.Errorf("apply[%d]: %w", i, err)
+				}
+				overlay.Apply = append(overlay.Apply, networkPolicy)
+			}
+			for _, d := range doc.Delete {
+				overlay.Delete = append(overlay.Delete, types.NamespacedName{Namespace: defaultNamespace(d.Namespace), Name: d.Name})
+			}
+		case "NetworkPolicy":
+			networkPolicy, err := decodeNetworkPolicy(raw.Raw, false)
+			if err != nil {
+				return policy.Overlay{}, err
+			}
+			overlay.Apply = append(overlay.Apply, networkPolicy)
+		case "NetworkPolicyList", "List":
+			// NetworkPolicyListはnetworking.k8s.io/v1，Listはv1で，Listの要素はkindを必ず持つ
+			isList := doc.Kind == "List"
+			if (isList && doc.APIVersion != "v1") || (!isList && doc.APIVersion != networkPolicyAPIVersion) {
+				return policy.Overlay{}, fmt.Errorf("unsupported apiVersion %q for kind %s", doc.APIVersion, doc.Kind)
+			}
+			var list struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			if err := json.Unmarshal(raw.Raw, &list); err != nil {
+				return policy.Overlay{}, err
+			}
+			for i, item := range list.Items {
+				networkPolicy, err := decodeNetworkPolicy(item, !isList)
+				if err != nil {
+					return policy.Overlay{}, fmt.Errorf("items[%d]: %w", i, err)
+				}
+				overlay.Apply = append(overlay.Apply, networkPolicy)
+			}
+		default:
+			return policy.Overlay{}, fmt.Errorf("unsupported kind %q", doc.Kind)
+		}
+	}
+
+	for i := range overlay.Apply {
+		if overlay.Apply[i].Name == "" {
+			return policy.Overlay{}, errors.New("metadata.name is required for every NetworkPolicy")
+		}
+		overlay.Apply[i].Namespace = defaultNamespace(overlay.Apply[i].Namespace)
+	}
+	for _, d := range overlay.Delete {
+		if d.Name == "" {
+			return policy.Overlay{}, errors.New("name is required for every deletion")
+		}
+	}
+
+	if len(overlay.Apply) == 0 && len(overlay.Delete) == 0 {
+		return policy.Overlay{}, errors.New("no NetworkPolicy changes in request body")
+	}
+	return overlay, nil
+}
+
+// networking.k8s.io/v1のNetworkPolicyを読む．allowEmptyTypeならapiVersion, kindの省略を許す
+func decodeNetworkPolicy(raw []byte, allowEmptyType bool) (netv1.NetworkPolicy, error) {
+	var networkPolicy netv1.NetworkPolicy
+	if err := json.Unmarshal(raw, &networkPolicy); err != nil {
+		return netv1.NetworkPolicy{}, err
+	}
+	if allowEmptyType && networkPolicy.APIVersion == "" && networkPolicy.Kind == "" {
+		return networkPolicy, nil
+	}
+	if networkPolicy.Kind != "NetworkPolicy" {
+		return netv1.NetworkPolicy{}, fmt.Errorf("unsupported kind %q", networkPolicy.Kind)
+	}
+	if networkPolicy.APIVersion != networkPolicyAPIVersion {
+		return netv1.NetworkPolicy{}, fmt.Errorf("unsupported apiVersion %q for kind NetworkPolicy, only %s is supported", networkPolicy.APIVersion, networkPolicyAPIVersion)
+	}
+	return networkPolicy, nil
+}
+
+func defaultNamespace(namespace string) string {
+	if namespace == "" {
+		return v1.NamespaceDefault
+	}
+	return namespace
+}
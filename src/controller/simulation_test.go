@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOverlay(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantApply  []string
+		wantDelete []string
+		wantErr    bool
+	}{
+		{
+			name: "NetworkPolicyのYAML",
+			body: `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny-all
+spec:
+  podSelector: {}
+`,
+			wantApply: []string{"default/deny-all"},
+		},
+		{
+			name: "複数ドキュメントとNetworkPolicyList",
+			body: `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicyList
+items:
+- metadata: {name: a, namespace: web}
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata: {name: b}
+`,
+			wantApply: []string{"web/a", "default/b"},
+		},
+		{
+			name:       "apply, delete",
+			body:       `{"apply": [{"metadata": {"name": "a"}}], "delete": [{"namespace": "web", "name": "b"}]}`,
+			wantApply:  []string{"default/a"},
+			wantDelete: []string{"web/b"},
+		},
+		{
+			name: "CalicoのNetworkPolicyは受け付けない",
+			body: `
+apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata:
+  name: calico
+spec:
+  selector: all()
+`,
+			wantErr: true,
+		},
+		{
+			name: "crd.projectcalico.org/v1も受け付けない",
+			body: `
+apiVersion: crd.projectcalico.org/v1
+kind: NetworkPolicy
+metadata:
+  name: calico
+`,
+			wantErr: true,
+		},
+		{
+			name: "ListにNetworkPolicy以外の要素がある",
+			body: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: c}
+`,
+			wantErr: true,
+		},
+		{
+			name: "Listの要素のkindは省略できない",
+			body: `
+apiVersion: v1
+kind: List
+items:
+- metadata: {name: c}
+`,
+			wantErr: true,
+		},
+		{
+			name:    "applyの要素のapiVersionが違う",
+			body:    `{"apply": [{"apiVersion": "cilium.io/v2", "kind": "NetworkPolicy", "metadata": {"name": "a"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "未対応のkind",
+			body:    `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "a"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "nameがない",
+			body:    `{"apiVersion": "networking.k8s.io/v1", "kind": "NetworkPolicy"}`,
+			wantErr: true,
+		},
+		{
+			name:    "変更がない",
+			body:    `{}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overlay, err := parseOverlay([]byte(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseOverlay() = %+v, want error", overlay)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOverlay() error = %v", err)
+			}
+			var apply []string
+			for _, p := range overlay.Apply {
+				apply = append(apply, p.Namespace+"/"+p.Name)
+			}
+			if !reflect.DeepEqual(apply, tt.wantApply) {
+				t.Errorf("parseOverlay() apply = %v, want %v", apply, tt.wantApply)
+			}
+			var deletes []string
+			for _, d := range overlay.Delete {
+				deletes = append(deletes, d.String())
+			}
+			if !reflect.DeepEqual(deletes, tt.wantDelete) {
+				t.Errorf("parseOverlay() delete = %v, want %v", deletes, tt.wantDelete)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/model"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"github.com/gin-gonic/gin"
+	"io"
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 変更が続いた場合に通信可否を再計算する間隔
+	watchRecomputeInterval = time.Second
+	// プロキシに切断されないように何も送らない間も送るコメントの間隔
+	watchKeepaliveInterval = 15 * time.Second
+	// 購読者ごとにためておけるイベントの数．超えた分は捨ててresyncを送る
+	watchBufferSize = 256
+)
+
+// watchMessage は購読者に送るイベントと，通信可否の再計算の範囲を決めるための情報
+type watchMessage struct {
+	event model.WatchEvent
+	// policyの変更の場合は変更前後のpolicy．どちらかが選択するPodの通信可否のみを再計算する
+	policies []policy.PolicySet
+	// CalicoのTierの変更など，全ての通信可否が変わりうる
+	all bool
+}
+
+type watchSubscriber struct {
+	events  chan watchMessage
+	dropped atomic.Bool
+}
+
+func (c *clusterCache) subscribe() *watchSubscriber {
+	s := &watchSubscriber{events: make(chan watchMessage, watchBufferSize)}
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	c.subscribers[s] = struct{}{}
+	return s
+}
+
+func (c *clusterCache) unsubscribe(s *watchSubscriber) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	delete(c.subscribers, s)
+}
+
+// publish はイベントを全ての購読者に送る．初回の同期中の追加はイベントにしない
+func (c *clusterCache) publish(event model.WatchEvent) {
+	c.publishMessage(watchMessage{event: event})
+}
+
+func (c *clusterCache) publishMessage(message watchMessage) {
+	if synced, _ := c.status(); !synced {
+		return
+	}
+	message.event.Time = time.Now()
+
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	for s := range c.subscribers {
+		select {
+		case s.events <- message:
+		default:
+			s.dropped.Store(true)
+		}
+	}
+}
+
+// informerの変更をWatchEventに変換するハンドラーを登録する
+func (c *clusterCache) addWatchHandlers(pods cache.SharedIndexInformer, nodes cache.SharedIndexInformer, namespaces cache.SharedIndexInformer, networkPolicies cache.SharedIndexInformer) {
+	pods.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pod := obj.(*v1.Pod)
+			c.publish(newPodWatchEvent(model.WatchEventPodAdded, pod))
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			oldPod, newPod := oldObj.(*v1.Pod), newObj.(*v1.Pod)
+			if oldPod.ResourceVersion == newPod.ResourceVersion {
+				return
+			}
+			switch {
+			case oldPod.Spec.NodeName == "" && newPod.Spec.NodeName != "":
+				c.publish(newPodWatchEvent(model.WatchEventPodScheduled, newPod))
+			case oldPod.Spec.NodeName != newPod.Spec.NodeName:
+				event := newPodWatchEvent(model.WatchEventPodMoved, newPod)
+				event.PreviousNode = oldPod.Spec.NodeName
+				c.publish(event)
+			default:
+				// statusの細かな更新は通信可否に関係する項目が変わった場合のみ送る
+				changes := getPodChanges(oldPod, newPod)
+				if len(changes) == 0 {
+					return
+				}
+				event := newPodWatchEvent(model.WatchEventPodUpdated, newPod)
+				event.Changes = changes
+				c.publish(event)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if pod, ok := unwrapDeleted(obj).(*v1.Pod); ok {
+				c.publish(newPodWatchEvent(model.WatchEventPodDeleted, pod))
+			}
+		},
+	})
+
+	// ノードの更新はハートビートで頻繁に起こるので参加と離脱のみ送る
+	nodes.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.publish(model.WatchEvent{Type: model.WatchEventNodeAdded, Node: obj.(*v1.Node).Name})
+		},
+		DeleteFunc: func(obj interface{}) {
+			if node, ok := unwrapDeleted(obj).(*v1.Node); ok {
+				c.publish(model.WatchEvent{Type: model.WatchEventNodeRemoved, Node: node.Name})
+			}
+		},
+	})
+
+	// namespaceSelectorの結果が変わるのはラベルが変わった場合のみ
+	namespaces.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.publish(model.WatchEvent{Type: model.WatchEventNamespaceChanged, Namespace: obj.(*v1.Namespace).Name})
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			oldNamespace, newNamespace := oldObj.(*v1.Namespace), newObj.(*v1.Namespace)
+			if labels.Equals(oldNamespace.Labels, newNamespace.Labels) {
+				return
+			}
+			c.publish(model.WatchEvent{Type: model.WatchEventNamespaceChanged, Namespace: newNamespace.Name})
+		},
+		DeleteFunc: func(obj interface{}) {
+			if namespace, ok := unwrapDeleted(obj).(*v1.Namespace); ok {
+				c.publish(model.WatchEvent{Type: model.WatchEventNamespaceChanged, Namespace: namespace.Name})
+			}
+		},
+	})
+
+	// 更新では変更前後のどちらかのpolicyが選択するPodの通信可否が変わりうる
+	policyEvent := func(objs ...interface{}) {
+		message := watchMessage{event: model.WatchEvent{Type: model.WatchEventPolicyChanged}}
+		for _, obj := range objs {
+			p, ok := unwrapDeleted(obj).(*netv1.NetworkPolicy)
+			if !ok {
+				continue
+			}
+			message.event.Namespace = p.Namespace
+			message.event.Policy = &model.PolicyRef{Name: p.Name, Namespace: p.Namespace}
+			message.policies = append(message.policies, policy.PolicySet{NetworkPolicies: []netv1.NetworkPolicy{*p}})
+		}
+		if message.event.Policy != nil {
+			c.publishMessage(message)
+		}
+	}
+	networkPolicies.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { policyEvent(obj) },
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if oldObj.(*netv1.NetworkPolicy).ResourceVersion != newObj.(*netv1.NetworkPolicy).ResourceVersion {
+				policyEvent(oldObj, newObj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) { policyEvent(obj) },
+	})
+}
+
+// Calico, Cilium, AdminNetworkPolicyのCRDの変更をpolicy_changedのイベントにするハンドラーを登録する
+func (c *clusterCache) addCustomResourceWatchHandler(resource schema.GroupVersionResource, informer cache.SharedIndexInformer) {
+	policyEvent := func(objs ...interface{}) {
+		message := watchMessage{event: model.WatchEvent{Type: model.WatchEventPolicyChanged}}
+		for _, obj := range objs {
+			u, ok := unwrapDeleted(obj).(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			message.event.Namespace = u.GetNamespace()
+			message.event.Policy = &model.PolicyRef{Kind: u.GetKind(), Name: u.GetName(), Namespace: u.GetNamespace()}
+			policySet, ok := newCustomResourcePolicySet(resource, *u)
+			if !ok {
+				message.all = true
+				continue
+			}
+			message.policies = append(message.policies, policySet)
+		}
+		if message.event.Policy != nil {
+			c.publishMessage(message)
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { policyEvent(obj) },
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if oldObj.(*unstructured.Unstructured).GetResourceVersion() != newObj.(*unstructured.Unstructured).GetResourceVersion() {
+				policyEvent(oldObj, newObj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) { policyEvent(obj) },
+	})
+}
+
+// CRDのpolicy一つだけのPolicySetを作る．Tierは層のpolicy全体に影響するのでfalseを返す．
+// 変換できないpolicyはどのPodも選択しないので空のPolicySetを返す
+func newCustomResourcePolicySet(resource schema.GroupVersionResource, obj unstructured.Unstructured) (policy.PolicySet, bool) {
+	var res policy.PolicySet
+	switch resource {
+	case calicoTierResource:
+		return res, false
+	case calicoNetworkPolicyResource, calicoGlobalNetworkPolicyResource:
+		if p, err := policy.NewCalicoPolicy(obj); err == nil {
+			res.CalicoPolicies = []policy.CalicoPolicy{p}
+		}
+	case ciliumNetworkPolicyResource, ciliumClusterwideNetworkPolicyResource:
+		if p, err := policy.NewCiliumPolicy(obj); err == nil {
+			res.CiliumPolicies = []policy.CiliumPolicy{p}
+		}
+	case adminNetworkPolicyResource:
+		if p, err := policy.NewAdminNetworkPolicy(obj); err == nil {
+			res.AdminNetworkPolicies = []policy.AdminNetworkPolicy{p}
+		}
+	case baselineAdminNetworkPolicyResource:
+		if p, err := policy.NewAdminNetworkPolicy(obj); err == nil {
+			res.BaselineAdminNetworkPolicies = []policy.AdminNetworkPolicy{p}
+		}
+	}
+	return res, true
+}
+
+func newPodWatchEvent(eventType string, pod *v1.Pod) model.WatchEvent {
+	viewModel := model.Cast2PodViewModel(*pod)
+	return model.WatchEvent{
+		Type:      eventType,
+		Node:      pod.Spec.NodeName,
+		Namespace: pod.Namespace,
+		Pod:       &viewModel,
+	}
+}
+
+// 通信可否の判定に使う項目のうち変化したもの
+func getPodChanges(oldPod *v1.Pod, newPod *v1.Pod) []string {
+	changes := make([]string, 0)
+	if !labels.Equals(oldPod.Labels, newPod.Labels) {
+		changes = append(changes, "labels")
+	}
+	if policy.ClassifyPod(*oldPod) != policy.ClassifyPod(*newPod) {
+		changes = append(changes, "state")
+	}
+	if !reflect.DeepEqual(policy.GetPodIPs(*oldPod), policy.GetPodIPs(*newPod)) {
+		changes = append(changes, "ips")
+	}
+	return changes
+}
+
+// 削除を見逃した場合はDeletedFinalStateUnknownに包まれている
+func unwrapDeleted(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
+
+// Watch はPod, ノード, Network Policy, Calico等のpolicyの変更をServer-Sent Eventsで送り続ける．
+// ?namespace=(カンマ区切り)でPodとpolicyのイベントをnamespaceで絞り，?pod=namespace/nameでそのPodの通信可否の変化を購読する．
+// ?pod=のみの場合は通信可否のイベントだけを送る
+func (c *Ctrl) Watch() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fmt.Println("変更の監視")
+
+		namespaces := make(map[string]struct{})
+		if v := ctx.Query("namespace"); v != "" {
+			for _, ns := range strings.Split(v, ",") {
+				namespaces[strings.TrimSpace(ns)] = struct{}{}
+			}
+		}
+
+		var target *v1.Pod
+		if v := ctx.Query("pod"); v != "" {
+			namespace, name, err := parsePodRef(v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "pod: " + err.Error(),
+				})
+				return
+			}
+			pod, err := c.findPod(namespace, name)
+			if err != nil {
+				respondPodError(ctx, err)
+				return
+			}
+			target = &pod
+		}
+
+		// 購読を先に始めて，最初の通信可否の計算中の変更も取りこぼさないようにする
+		subscriber := c.cache.subscribe()
+		defer c.cache.unsubscribe(subscriber)
+
+		var accessPods []model.AccessPod
+		if target != nil {
+			var err error
+			accessPods, err = c.evaluateAccessPods(target.Namespace, target.Name)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+
+		ctx.Header("Content-Type", "text/event-stream")
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("Connection", "keep-alive")
+		ctx.Status(http.StatusOK)
+		if target != nil {
+			ctx.SSEvent(model.WatchEventReachability, model.WatchEvent{
+				Type:         model.WatchEventReachability,
+				Time:         time.Now(),
+				Reachability: &model.ReachabilityDiff{Target: model.PodRefViewModel(*target), Changed: accessPods, Removed: []model.PodRef{}},
+			})
+		}
+
+		recompute := time.NewTicker(watchRecomputeInterval)
+		defer recompute.Stop()
+		keepalive := time.NewTicker(watchKeepaliveInterval)
+		defer keepalive.Stop()
+		dirty := newReachabilityDirty()
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case message := <-subscriber.events:
+				if subscriber.dropped.Swap(false) {
+					ctx.SSEvent(model.WatchEventResync, model.WatchEvent{Type: model.WatchEventResync, Time: time.Now()})
+					dirty.all = true
+				}
+				if target != nil {
+					dirty.add(message, *target)
+				}
+				if isWatchedEvent(message.event, namespaces, target) {
+					ctx.SSEvent(message.event.Type, message.event)
+				}
+			case <-recompute.C:
+				if target == nil || dirty.isEmpty() {
+					return true
+				}
+				after, err := c.updateAccessPods(*target, accessPods, dirty)
+				dirty = newReachabilityDirty()
+				if err != nil {
+					// 対象のPodが削除された場合などは再作成されるまで待ち，全て計算し直す
+					dirty.all = true
+					return true
+				}
+				diff := model.DiffAccessPods(model.PodRefViewModel(*target), accessPods, after)
+				accessPods = after
+				if diff.IsEmpty() {
+					return true
+				}
+				ctx.SSEvent(model.WatchEventReachabilityChanged, model.WatchEvent{
+					Type:         model.WatchEventReachabilityChanged,
+					Time:         time.Now(),
+					Reachability: &diff,
+				})
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			return true
+		})
+	}
+}
+
+// ?namespace=, ?pod=の指定に合うイベントか
+func isWatchedEvent(event model.WatchEvent, namespaces map[string]struct{}, target *v1.Pod) bool {
+	if target != nil && len(namespaces) == 0 {
+		return false
+	}
+	if len(namespaces) == 0 || event.Namespace == "" {
+		return true
+	}
+	_, ok := namespaces[event.Namespace]
+	return ok
+}
+
+// reachabilityDirty は購読しているPodの通信可否のうち，前回の計算から変わりうる範囲．
+// Podの変更はそのPodとの通信可否のみ，namespaceの変更はそのnamespaceのPodとの通信可否のみ，
+// policyの変更はpolicyが選択するPodとの通信可否のみが変わる．購読しているPod自身が関係する場合は全て計算し直す
+type reachabilityDirty struct {
+	all        bool
+	pods       map[types.NamespacedName]struct{}
+	namespaces map[string]struct{}
+	policies   []policy.PolicySet
+}
+
+func newReachabilityDirty() *reachabilityDirty {
+	return &reachabilityDirty{
+		pods:       make(map[types.NamespacedName]struct{}),
+		namespaces: make(map[string]struct{}),
+	}
+}
+
+func (d *reachabilityDirty) isEmpty() bool {
+	return !d.all && len(d.pods) == 0 && len(d.namespaces) == 0 && len(d.policies) == 0
+}
+
+func (d *reachabilityDirty) add(message watchMessage, target v1.Pod) {
+	event := message.event
+	switch event.Type {
+	case model.WatchEventNodeAdded, model.WatchEventNodeRemoved:
+		// ノードの参加と離脱は通信可否に関係しない
+	case model.WatchEventNamespaceChanged:
+		if event.Namespace == target.Namespace {
+			d.all = true
+			return
+		}
+		d.namespaces[event.Namespace] = struct{}{}
+	case model.WatchEventPolicyChanged:
+		if message.all {
+			d.all = true
+			return
+		}
+		d.policies = append(d.policies, message.policies...)
+	default:
+		if event.Pod == nil {
+			d.all = true
+			return
+		}
+		if event.Pod.Namespace == target.Namespace && event.Pod.Name == target.Name {
+			d.all = true
+			return
+		}
+		d.pods[types.NamespacedName{Namespace: event.Pod.Namespace, Name: event.Pod.Name}] = struct{}{}
+	}
+}
+
+// updateAccessPods はbeforeのうちdirtyの範囲の通信相手だけを計算し直す
+func (c *Ctrl) updateAccessPods(target v1.Pod, before []model.AccessPod, dirty *reachabilityDirty) ([]model.AccessPod, error) {
+	if dirty.all {
+		return c.evaluateAccessPods(target.Namespace, target.Name)
+	}
+
+	targetPod, err := c.findPod(target.Namespace, target.Name)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := c.cache.listPods()
+	if err != nil {
+		return nil, err
+	}
+	namespaceList, err := c.cache.listNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	// 変更されたpolicyが選択するPodを求める
+	for _, policySet := range dirty.policies {
+		for _, pod := range policy.NewEngineWithPolicySet(podList, namespaceList, policySet).SelectedPods() {
+			if pod.Namespace == targetPod.Namespace && pod.Name == targetPod.Name {
+				return c.evaluateAccessPods(target.Namespace, target.Name)
+			}
+			dirty.pods[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}] = struct{}{}
+		}
+	}
+
+	beforeMap := make(map[types.NamespacedName]model.AccessPod, len(before))
+	for _, v := range before {
+		beforeMap[types.NamespacedName{Namespace: v.Namespace, Name: v.Name}] = v
+	}
+	var engine *policy.Engine
+	res := make([]model.AccessPod, 0, len(podList))
+	for _, pod := range podList {
+		key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+		_, podChanged := dirty.pods[key]
+		_, namespaceChanged := dirty.namespaces[pod.Namespace]
+		if v, ok := beforeMap[key]; ok && !podChanged && !namespaceChanged {
+			res = append(res, v)
+			continue
+		}
+
+		if engine == nil {
+			policySet, err := c.listPolicySet()
+			if err != nil {
+				return nil, err
+			}
+			engine = policy.NewEngineWithPolicySet(podList, namespaceList, policySet)
+		}
+		res = append(res, model.AccessPodViewModel(engine.EvaluatePeer(targetPod, pod)))
+	}
+	return res, nil
+}
+
+// 対象のPodと全Podとの通信可否を求める
+func (c *Ctrl) evaluateAccessPods(namespace string, name string) ([]model.AccessPod, error) {
+	targetPod, err := c.findPod(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := c.cache.listPods()
+	if err != nil {
+		return nil, err
+	}
+	policySet, err := c.listPolicySet()
+	if err != nil {
+		return nil, err
+	}
+	namespaceList, err := c.cache.listNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	engine := policy.NewEngineWithPolicySet(podList, namespaceList, policySet)
+	result, err := engine.Evaluate(targetPod)
+	if err != nil {
+		return nil, err
+	}
+	return model.PodDetail(result).AccessPods, nil
+}
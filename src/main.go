@@ -2,15 +2,28 @@ package main
 
 import (
 	"github.com/asuyasuya/k8s-vis-backend/src/config"
-	"github.com/asuyasuya/k8s-vis-backend/src/controller"
 )
 
 func main() {
-	clientset, err := config.NewClient()
+	options := config.ParseFlags()
+
+	clusters, err := config.NewClusters(options)
 	if err != nil {
 		panic(err.Error())
 	}
-	ctrl := controller.NewController(clientset)
-	router := config.GetRouter(ctrl)
+
+	if options.Dump != "" {
+		ctrl, err := clusters.Default()
+		if err != nil {
+			panic(err.Error())
+		}
+		if err := ctrl.Dump(options.Dump); err != nil {
+			panic(err.Error())
+		}
+		return
+	}
+
+	clusters.StartCache(make(chan struct{}))
+	router := config.GetRouter(clusters)
 	router.Run(":8080")
 }
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+type ClusterViewModel struct {
+	Name string `json:"name"`
+	// kubeconfigのcontext名，snapshotの場合は空
+	Context string `json:"context"`
+	Server  string `json:"server"`
+	Default bool   `json:"default"`
+	// キャッシュの同期が完了し，APIが使えるか
+	Ready      bool       `json:"ready"`
+	LastSynced *time.Time `json:"last_synced"`
+	// 接続の設定に失敗した，または同期の後にAPIサーバーとの通信に失敗した場合のエラー
+	Error string `json:"error,omitempty"`
+}
+
+type ClusterListViewModel struct {
+	TotalCluster int                `json:"total_cluster"`
+	Default      string             `json:"default"`
+	Clusters     []ClusterViewModel `json:"clusters"`
+}
@@ -0,0 +1,233 @@
+package model
+
+import (
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"strconv"
+)
+
+type ExposureViewModel struct {
+	TotalRoute int             `json:"total_route"`
+	Routes     []ExposureRoute `json:"routes"`
+	// バックエンドのいずれかにコントローラーのPodから通信できない経路の数
+	TotalBlocked int `json:"total_blocked"`
+	// 変換できなかったGateway, HTTPRouteとpolicyの警告
+	Warnings []Warning `json:"warnings"`
+}
+
+// ExposureRoute はhost/pathからServiceを経てPodに至る経路
+type ExposureRoute struct {
+	// IngressまたはHTTPRoute
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// IngressではIngressClass，HTTPRouteでは親のGatewayのGatewayClass
+	Classes []string `json:"classes"`
+	// HTTPRouteの親のGateway("namespace/name")
+	Gateways []string `json:"gateways"`
+	// 空の場合は全てのホスト
+	Host     string          `json:"host"`
+	Path     string          `json:"path"`
+	PathType string          `json:"path_type"`
+	Service  ExposureService `json:"service"`
+	// 通信元として評価したコントローラーのPod
+	Controllers []PodRef          `json:"controllers"`
+	Backends    []ExposureBackend `json:"backends"`
+	Blocked     bool              `json:"blocked"`
+}
+
+type ExposureService struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// 数値または名前付きのServiceのポート
+	Port string `json:"port"`
+	// Serviceが存在するか
+	Found bool `json:"found"`
+}
+
+type ExposureBackend struct {
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace"`
+	Ips        []string `json:"ips"`
+	Ready      bool     `json:"ready"`
+	State      string   `json:"state"`
+	Protocol   string   `json:"protocol"`
+	TargetPort int      `json:"target_port"`
+	// バックエンドのPodにingressで適用されたpolicy
+	Policies []AppliedPolicy `json:"policies"`
+	// このバックエンドのtargetPortに通信できないコントローラーのPod
+	BlockedFrom []PodRef `json:"blocked_from"`
+}
+
+// IngressRoutes はIngressのルールを経路の一覧にする．Serviceではなくresourceを指すバックエンドは含めない
+func IngressRoutes(ingress netv1.Ingress) []ExposureRoute {
+	classes := make([]string, 0, 1)
+	if ingress.Spec.IngressClassName != nil {
+		classes = append(classes, *ingress.Spec.IngressClassName)
+	} else if class, ok := ingress.Annotations["kubernetes.io/ingress.class"]; ok {
+		classes = append(classes, class)
+	}
+
+	res := make([]ExposureRoute, 0)
+	add := func(host string, path string, pathType string, backend netv1.IngressBackend) {
+		if backend.Service == nil {
+			return
+		}
+		port := backend.Service.Port.Name
+		if backend.Service.Port.Number != 0 {
+			port = strconv.Itoa(int(backend.Service.Port.Number))
+		}
+		res = append(res, ExposureRoute{
+			Kind:      "Ingress",
+			Name:      ingress.Name,
+			Namespace: ingress.Namespace,
+			Classes:   classes,
+			Gateways:  []string{},
+			Host:      host,
+			Path:      path,
+			PathType:  pathType,
+			Service: ExposureService{
+				Name:      backend.Service.Name,
+				Namespace: ingress.Namespace,
+				Port:      port,
+			},
+		})
+	}
+
+	if ingress.Spec.DefaultBackend != nil {
+		add("", "", "", *ingress.Spec.DefaultBackend)
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			pathType := ""
+			if path.PathType != nil {
+				pathType = string(*path.PathType)
+			}
+			add(rule.Host, path.Path, pathType, path.Backend)
+		}
+	}
+	return res
+}
+
+// HTTPRouteRoutes はHTTPRouteのhostname, match, backendRefの組ごとに経路を作る．gatewaysは"namespace/name"をキーとしたGateway
+func HTTPRouteRoutes(route HTTPRoute, gateways map[string]Gateway) []ExposureRoute {
+	classes := make([]string, 0)
+	parents := make([]string, 0, len(route.Spec.ParentRefs))
+	for _, ref := range route.Spec.ParentRefs {
+		if ref.Kind != nil && *ref.Kind != "Gateway" {
+			continue
+		}
+		namespace := route.Namespace
+		if ref.Namespace != nil {
+			namespace = *ref.Namespace
+		}
+		key := namespace + "/" + ref.Name
+		parents = append(parents, key)
+		if gateway, ok := gateways[key]; ok && !containsString(classes, gateway.Spec.GatewayClassName) {
+			classes = append(classes, gateway.Spec.GatewayClassName)
+		}
+	}
+
+	hosts := route.Spec.Hostnames
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+
+	res := make([]ExposureRoute, 0)
+	for _, rule := range route.Spec.Rules {
+		// matchesの省略時はPathPrefix "/"
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []HTTPRouteMatch{{}}
+		}
+		for _, ref := range rule.BackendRefs {
+			if (ref.Group != nil && *ref.Group != "") || (ref.Kind != nil && *ref.Kind != "Service") {
+				continue
+			}
+			namespace := route.Namespace
+			if ref.Namespace != nil {
+				namespace = *ref.Namespace
+			}
+			port := ""
+			if ref.Port != nil {
+				port = strconv.Itoa(int(*ref.Port))
+			}
+
+			for _, host := range hosts {
+				for _, match := range matches {
+					path, pathType := "/", "PathPrefix"
+					if match.Path != nil && match.Path.Value != nil {
+						path = *match.Path.Value
+					}
+					if match.Path != nil && match.Path.Type != nil {
+						pathType = *match.Path.Type
+					}
+					res = append(res, ExposureRoute{
+						Kind:      "HTTPRoute",
+						Name:      route.Name,
+						Namespace: route.Namespace,
+						Classes:   classes,
+						Gateways:  parents,
+						Host:      host,
+						Path:      path,
+						PathType:  pathType,
+						Service: ExposureService{
+							Name:      ref.Name,
+							Namespace: namespace,
+							Port:      port,
+						},
+					})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// ExposureBackends はServiceのportに対応するバックエンドとtargetPortの一覧を返す．portは数値または名前付きのServiceのポート
+func ExposureBackends(service v1.Service, port string, slices []discoveryv1.EndpointSlice, pods map[string]v1.Pod) []ExposureBackend {
+	res := make([]ExposureBackend, 0)
+	var servicePort *v1.ServicePort
+	for i, p := range service.Spec.Ports {
+		if p.Name == port || strconv.Itoa(int(p.Port)) == port {
+			servicePort = &service.Spec.Ports[i]
+			break
+		}
+	}
+	if servicePort == nil {
+		return res
+	}
+
+	for _, backend := range ServiceBackends(service, slices, pods, nil, nil) {
+		for _, p := range backend.Ports {
+			if p.Name != servicePort.Name || p.Port != int(servicePort.Port) {
+				continue
+			}
+			res = append(res, ExposureBackend{
+				Name:        backend.Name,
+				Namespace:   backend.Namespace,
+				Ips:         backend.Ips,
+				Ready:       backend.Ready,
+				State:       backend.State,
+				Protocol:    p.Protocol,
+				TargetPort:  p.TargetPort,
+				Policies:    []AppliedPolicy{},
+				BlockedFrom: []PodRef{},
+			})
+		}
+	}
+	return res
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Gateway はGateway APIのGatewayのうち公開経路の表示に使う部分
+type Gateway struct {
+	Name      string
+	Namespace string
+	Spec      GatewaySpec
+}
+
+type GatewaySpec struct {
+	GatewayClassName string            `json:"gatewayClassName"`
+	Listeners        []GatewayListener `json:"listeners,omitempty"`
+}
+
+type GatewayListener struct {
+	Name     string  `json:"name"`
+	Hostname *string `json:"hostname,omitempty"`
+	Port     int32   `json:"port"`
+	Protocol string  `json:"protocol"`
+}
+
+// HTTPRoute はGateway APIのHTTPRoute
+type HTTPRoute struct {
+	Name      string
+	Namespace string
+	Spec      HTTPRouteSpec
+}
+
+type HTTPRouteSpec struct {
+	ParentRefs []ParentReference `json:"parentRefs,omitempty"`
+	Hostnames  []string          `json:"hostnames,omitempty"`
+	Rules      []HTTPRouteRule   `json:"rules,omitempty"`
+}
+
+type ParentReference struct {
+	Group     *string `json:"group,omitempty"`
+	Kind      *string `json:"kind,omitempty"`
+	Namespace *string `json:"namespace,omitempty"`
+	Name      string  `json:"name"`
+}
+
+type HTTPRouteRule struct {
+	Matches     []HTTPRouteMatch `json:"matches,omitempty"`
+	BackendRefs []HTTPBackendRef `json:"backendRefs,omitempty"`
+}
+
+type HTTPRouteMatch struct {
+	Path *HTTPPathMatch `json:"path,omitempty"`
+}
+
+type HTTPPathMatch struct {
+	Type  *string `json:"type,omitempty"`
+	Value *string `json:"value,omitempty"`
+}
+
+type HTTPBackendRef struct {
+	Group     *string `json:"group,omitempty"`
+	Kind      *string `json:"kind,omitempty"`
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+	Port      *int32  `json:"port,omitempty"`
+}
+
+// NewGateway はdynamic clientで取得したGatewayを変換する
+func NewGateway(obj unstructured.Unstructured) (Gateway, error) {
+	res := Gateway{Name: obj.GetName(), Namespace: obj.GetNamespace()}
+	if err := convertUnstructuredSpec(obj, &res.Spec); err != nil {
+		return Gateway{}, fmt.Errorf("Gateway %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return res, nil
+}
+
+// NewHTTPRoute はdynamic clientで取得したHTTPRouteを変換する
+func NewHTTPRoute(obj unstructured.Unstructured) (HTTPRoute, error) {
+	res := HTTPRoute{Name: obj.GetName(), Namespace: obj.GetNamespace()}
+	if err := convertUnstructuredSpec(obj, &res.Spec); err != nil {
+		return HTTPRoute{}, fmt.Errorf("HTTPRoute %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return res, nil
+}
+
+// dynamic clientで取得したオブジェクトのspecを構造体に変換する
+func convertUnstructuredSpec(obj unstructured.Unstructured, spec interface{}) error {
+	b, err := json.Marshal(obj.Object["spec"])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, spec)
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"sort"
+	"strings"
+)
+
+const (
+	GraphNodeKindNode      = "node"
+	GraphNodeKindNamespace = "namespace"
+	GraphNodeKindPod       = "pod"
+	GraphNodeKindExternal  = "external"
+	// ノードに割り当てられていないPodをまとめる親
+	GraphNodeKindUnscheduled = "unscheduled"
+
+	GraphEdgeKindIngress = "ingress"
+	GraphEdgeKindEgress  = "egress"
+	GraphEdgeKindAllowed = "allowed"
+)
+
+// Graph はDOT, Mermaid, GraphML, Cytoscape.jsに書き出すための有向グラフ．親子関係はParentで1段のみ表す
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+type GraphNode struct {
+	Id    string
+	Label string
+	Kind  string
+	// 親のノードのId．ない場合は空
+	Parent string
+}
+
+type GraphEdge struct {
+	Id     string
+	Source string
+	Target string
+	// 許可されているポート
+	Label string
+	Kind  string
+}
+
+// Idで参照される親ノードを持つか
+func (g Graph) hasChildren(id string) bool {
+	for _, n := range g.Nodes {
+		if n.Parent == id {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeListGraph はノードを親，Podを子としたグラフを作る．ノードに割り当てられていないPodはunscheduledを親にする
+func NodeListGraph(nodeList NodeListViewModel) Graph {
+	res := Graph{Nodes: make([]GraphNode, 0), Edges: make([]GraphEdge, 0)}
+	addPods := func(parentId string, pods []PodViewModel) {
+		for _, pod := range pods {
+			res.Nodes = append(res.Nodes, GraphNode{
+				Id:     graphPodId(pod.Namespace, pod.Name),
+				Label:  pod.Namespace + "/" + pod.Name,
+				Kind:   GraphNodeKindPod,
+				Parent: parentId,
+			})
+		}
+	}
+	for _, node := range nodeList.Nodes {
+		nodeId := "node:" + node.Name
+		res.Nodes = append(res.Nodes, GraphNode{Id: nodeId, Label: node.Name, Kind: GraphNodeKindNode})
+		addPods(nodeId, node.Pods)
+	}
+	if len(nodeList.Unscheduled.Pods) != 0 {
+		res.Nodes = append(res.Nodes, GraphNode{Id: "unscheduled", Label: "unscheduled", Kind: GraphNodeKindUnscheduled})
+		addPods("unscheduled", nodeList.Unscheduled.Pods)
+	}
+	return res
+}
+
+// PodDetailGraph は対象のPodと通信できるPod，クラスター外の範囲をnamespaceごとにまとめたグラフを作る．
+// ingressは通信相手から対象のPod，egressは対象のPodから通信相手への辺になる
+func PodDetailGraph(detail PodDetailViewModel) Graph {
+	builder := newGraphBuilder()
+	targetId := builder.addPod(detail.Namespace, detail.Name)
+
+	for _, peer := range detail.AccessPods {
+		if peer.Namespace == detail.Namespace && peer.Name == detail.Name {
+			continue
+		}
+		if !peer.Ingress.CanAccess && !peer.Egress.CanAccess {
+			continue
+		}
+		peerId := builder.addPod(peer.Namespace, peer.Name)
+		if peer.Ingress.CanAccess {
+			builder.addEdge(peerId, targetId, formatPortInfoList(peer.Ingress.Ports), GraphEdgeKindIngress)
+		}
+		if peer.Egress.CanAccess {
+			builder.addEdge(targetId, peerId, formatPortInfoList(peer.Egress.Ports), GraphEdgeKindEgress)
+		}
+	}
+
+	for i, peer := range detail.ExternalIngress {
+		id := builder.addExternal(fmt.Sprintf("external:ingress:%d", i), peer.Cidrs)
+		builder.addEdge(id, targetId, formatPortInfoList(peer.Ports), GraphEdgeKindIngress)
+	}
+	for i, peer := range detail.ExternalEgress {
+		id := builder.addExternal(fmt.Sprintf("external:egress:%d", i), peer.Cidrs)
+		builder.addEdge(targetId, id, formatPortInfoList(peer.Ports), GraphEdgeKindEgress)
+	}
+	return builder.graph
+}
+
+// ReachabilityMatrixGraph はPod同士の許可されている通信を辺としたグラフを作る．自身への通信は含めない
+func ReachabilityMatrixGraph(matrix policy.Matrix) Graph {
+	builder := newGraphBuilder()
+	ids := make([]string, 0, len(matrix.Pods))
+	for _, pod := range matrix.Pods {
+		ids = append(ids, builder.addPod(pod.Namespace, pod.Name))
+	}
+	for _, cell := range matrix.Cells {
+		if cell.From == cell.To {
+			continue
+		}
+		builder.addEdge(ids[cell.From], ids[cell.To], formatPortInfoList(Cast2PortInfoList(cell.Ports)), GraphEdgeKindAllowed)
+	}
+	return builder.graph
+}
+
+// Podをnamespaceごとにまとめてグラフを組み立てる
+type graphBuilder struct {
+	graph Graph
+	nodes map[string]struct{}
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{
+		graph: Graph{Nodes: make([]GraphNode, 0), Edges: make([]GraphEdge, 0)},
+		nodes: make(map[string]struct{}),
+	}
+}
+
+func (b *graphBuilder) addNode(node GraphNode) {
+	if _, ok := b.nodes[node.Id]; ok {
+		return
+	}
+	b.nodes[node.Id] = struct{}{}
+	b.graph.Nodes = append(b.graph.Nodes, node)
+}
+
+func (b *graphBuilder) addPod(namespace string, name string) string {
+	namespaceId := "namespace:" + namespace
+	b.addNode(GraphNode{Id: namespaceId, Label: namespace, Kind: GraphNodeKindNamespace})
+	id := graphPodId(namespace, name)
+	b.addNode(GraphNode{Id: id, Label: name, Kind: GraphNodeKindPod, Parent: namespaceId})
+	return id
+}
+
+func (b *graphBuilder) addExternal(id string, cidrs []string) string {
+	b.addNode(GraphNode{Id: id, Label: strings.Join(cidrs, ", "), Kind: GraphNodeKindExternal})
+	return id
+}
+
+func (b *graphBuilder) addEdge(source string, target string, label string, kind string) {
+	b.graph.Edges = append(b.graph.Edges, GraphEdge{
+		Id:     fmt.Sprintf("edge:%d", len(b.graph.Edges)),
+		Source: source,
+		Target: target,
+		Label:  label,
+		Kind:   kind,
+	})
+}
+
+func graphPodId(namespace string, name string) string {
+	return "pod:" + namespace + "/" + name
+}
+
+// ポート一覧を"TCP/80, UDP/53"のような文字列にする．全ポートは"any/all"になる
+func formatPortInfoList(ports []PortInfo) string {
+	if len(ports) == 0 {
+		return "none"
+	}
+	res := make([]string, 0, len(ports))
+	for _, p := range ports {
+		protocol := "any"
+		if p.Protocol != nil {
+			protocol = fmt.Sprint(*p.Protocol)
+		}
+		port := "all"
+		switch {
+		case p.Port != nil && p.EndPort != nil:
+			port = fmt.Sprintf("%v-%v", *p.Port, *p.EndPort)
+		case p.Port != nil:
+			port = fmt.Sprint(*p.Port)
+		case p.PortName != nil:
+			port = fmt.Sprint(*p.PortName)
+		}
+		res = append(res, protocol+"/"+port)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	GraphFormatDOT       = "dot"
+	GraphFormatMermaid   = "mermaid"
+	GraphFormatGraphML   = "graphml"
+	GraphFormatCytoscape = "cytoscape"
+)
+
+// FormatDOT はGraphvizのDOT形式にする．子を持つノードはclusterのsubgraphになる
+func FormatDOT(g Graph) string {
+	var b strings.Builder
+	b.WriteString("digraph k8s {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+
+	writeNode := func(indent string, n GraphNode) {
+		fmt.Fprintf(&b, "%s%s [label=%s, class=%s];\n", indent, quoteDOT(n.Id), quoteDOT(n.Label), quoteDOT(n.Kind))
+	}
+	for i, n := range g.Nodes {
+		if n.Parent != "" {
+			continue
+		}
+		if !g.hasChildren(n.Id) {
+			writeNode("  ", n)
+			continue
+		}
+		fmt.Fprintf(&b, "  subgraph %s {\n", quoteDOT(fmt.Sprintf("cluster_%d", i)))
+		fmt.Fprintf(&b, "    label=%s;\n", quoteDOT(n.Label))
+		for _, child := range g.Nodes {
+			if child.Parent == n.Id {
+				writeNode("    ", child)
+			}
+		}
+		b.WriteString("  }\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s, class=%s];\n", quoteDOT(e.Source), quoteDOT(e.Target), quoteDOT(e.Label), quoteDOT(e.Kind))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func quoteDOT(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// FormatMermaid はMermaidのflowchartにする．Mermaidのidに使えない文字があるのでノードは連番のidにする
+func FormatMermaid(g Graph) string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.Id] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		if n.Parent != "" {
+			continue
+		}
+		if !g.hasChildren(n.Id) {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n.Id], escapeMermaid(n.Label))
+			continue
+		}
+		fmt.Fprintf(&b, "  subgraph %s[\"%s\"]\n", ids[n.Id], escapeMermaid(n.Label))
+		for _, child := range g.Nodes {
+			if child.Parent == n.Id {
+				fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids[child.Id], escapeMermaid(child.Label))
+			}
+		}
+		b.WriteString("  end\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -->|\"%s\"| %s\n", ids[e.Source], escapeMermaid(e.Label), ids[e.Target])
+	}
+	return b.String()
+}
+
+func escapeMermaid(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;", "\n", " ").Replace(s)
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	Id       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	Id          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Id     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// FormatGraphML はGraphMLにする．親子関係はparentの属性で表す
+func FormatGraphML(g Graph) ([]byte, error) {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{Id: "node_label", For: "node", AttrName: "label", AttrType: "string"},
+			{Id: "node_kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{Id: "node_parent", For: "node", AttrName: "parent", AttrType: "string"},
+			{Id: "edge_label", For: "edge", AttrName: "label", AttrType: "string"},
+			{Id: "edge_kind", For: "edge", AttrName: "kind", AttrType: "string"},
+		},
+		Graph: graphMLGraph{
+			Id:          "k8s",
+			EdgeDefault: "directed",
+			Nodes:       make([]graphMLNode, 0, len(g.Nodes)),
+			Edges:       make([]graphMLEdge, 0, len(g.Edges)),
+		},
+	}
+	for _, n := range g.Nodes {
+		data := []graphMLData{{Key: "node_label", Value: n.Label}, {Key: "node_kind", Value: n.Kind}}
+		if n.Parent != "" {
+			data = append(data, graphMLData{Key: "node_parent", Value: n.Parent})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{Id: n.Id, Data: data})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Id:     e.Id,
+			Source: e.Source,
+			Target: e.Target,
+			Data:   []graphMLData{{Key: "edge_label", Value: e.Label}, {Key: "edge_kind", Value: e.Kind}},
+		})
+	}
+
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// CytoscapeViewModel はCytoscape.jsのelementsの形式
+type CytoscapeViewModel struct {
+	Elements CytoscapeElements `json:"elements"`
+}
+
+type CytoscapeElements struct {
+	Nodes []CytoscapeElement `json:"nodes"`
+	Edges []CytoscapeElement `json:"edges"`
+}
+
+type CytoscapeElement struct {
+	Data CytoscapeData `json:"data"`
+}
+
+type CytoscapeData struct {
+	Id     string `json:"id"`
+	Label  string `json:"label"`
+	Kind   string `json:"kind"`
+	Parent string `json:"parent,omitempty"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// FormatCytoscape はCytoscape.jsのJSONにする．親子関係はcompound nodeのparentで表す
+func FormatCytoscape(g Graph) CytoscapeViewModel {
+	res := CytoscapeViewModel{
+		Elements: CytoscapeElements{
+			Nodes: make([]CytoscapeElement, 0, len(g.Nodes)),
+			Edges: make([]CytoscapeElement, 0, len(g.Edges)),
+		},
+	}
+	for _, n := range g.Nodes {
+		res.Elements.Nodes = append(res.Elements.Nodes, CytoscapeElement{Data: CytoscapeData{
+			Id:     n.Id,
+			Label:  n.Label,
+			Kind:   n.Kind,
+			Parent: n.Parent,
+		}})
+	}
+	for _, e := range g.Edges {
+		res.Elements.Edges = append(res.Elements.Edges, CytoscapeElement{Data: CytoscapeData{
+			Id:     e.Id,
+			Label:  e.Label,
+			Kind:   e.Kind,
+			Source: e.Source,
+			Target: e.Target,
+		}})
+	}
+	return res
+}
@@ -1,7 +1,26 @@
 package model
 
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	v1 "k8s.io/api/core/v1"
+	"time"
+)
+
 type PodViewModel struct {
-	Name string `json:"name"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Phase     string `json:"phase"`
+	// running, pending, terminating, hostNetwork, completed
+	State string `json:"state"`
+}
+
+func Cast2PodViewModel(pod v1.Pod) PodViewModel {
+	return PodViewModel{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Phase:     string(pod.Status.Phase),
+		State:     string(policy.ClassifyPod(pod)),
+	}
 }
 
 type NodeViewModel struct {
@@ -10,7 +29,16 @@ type NodeViewModel struct {
 	Pods     []PodViewModel `json:"pods"`
 }
 
+// UnscheduledViewModel はノードに割り当てられていないPod．stateはpending
+type UnscheduledViewModel struct {
+	TotalPod int            `json:"total_pod"`
+	Pods     []PodViewModel `json:"pods"`
+}
+
 type NodeListViewModel struct {
-	TotalNode int             `json:"total_node"`
-	Nodes     []NodeViewModel `json:"nodes"`
+	TotalNode   int                  `json:"total_node"`
+	Nodes       []NodeViewModel      `json:"nodes"`
+	Unscheduled UnscheduledViewModel `json:"unscheduled"`
+	// 元にしたキャッシュが最後に更新された時刻
+	LastSynced time.Time `json:"last_synced"`
 }
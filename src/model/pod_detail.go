@@ -1,18 +1,112 @@
 package model
 
 import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
 	v1 "k8s.io/api/core/v1"
-	netv1 "k8s.io/api/networking/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"time"
 )
 
 type PodDetailViewModel struct {
-	Name        string      `json:"name"`
-	Ip          string      `json:"ip"`
-	Namespace   string      `json:"namespace"`
-	Labels      []Label     `json:"labels"`
-	AccessPods  []AccessPod `json:"access_pods"`
-	PolicyNames []string    `json:"policy_names"`
+	Name        string          `json:"name"`
+	Ip          string          `json:"ip"`
+	Ips         []string        `json:"ips"`
+	Namespace   string          `json:"namespace"`
+	State       string          `json:"state"`
+	Labels      []Label         `json:"labels"`
+	AccessPods  []AccessPod     `json:"access_pods"`
+	PolicyNames []string        `json:"policy_names"`
+	Policies    []AppliedPolicy `json:"policies"`
+	Warnings    []Warning       `json:"warnings"`
+	// クラスター外との通信．ingressは外から，egressは外への通信
+	ExternalIngress []ExternalPeer `json:"external_ingress"`
+	ExternalEgress  []ExternalPeer `json:"external_egress"`
+	// 元にしたキャッシュが最後に更新された時刻
+	LastSynced time.Time `json:"last_synced"`
+}
+
+func PodDetail(result policy.Result) PodDetailViewModel {
+	accessPods := make([]AccessPod, 0, len(result.Peers))
+	for _, peer := range result.Peers {
+		accessPods = append(accessPods, AccessPodViewModel(peer))
+	}
+
+	return PodDetailViewModel{
+		Name:            result.Target.Name,
+		Ip:              result.Target.Status.PodIP,
+		Ips:             policy.GetPodIPs(result.Target),
+		Namespace:       result.Target.Namespace,
+		State:           string(policy.ClassifyPod(result.Target)),
+		Labels:          LabelViewModel(result.Target),
+		AccessPods:      accessPods,
+		ExternalIngress: ExternalPeerViewModel(result.ExternalIngress),
+		ExternalEgress:  ExternalPeerViewModel(result.ExternalEgress),
+		PolicyNames:     result.PolicyNames,
+		Policies:        AppliedPolicyViewModel(result.AppliedPolicies),
+		Warnings:        WarningViewModel(result.Warnings),
+	}
+}
+
+// AppliedPolicy はPodに適用されたpolicy．engineはkubernetes, calico, cilium
+type AppliedPolicy struct {
+	Engine    string `json:"engine"`
+	Tier      string `json:"tier"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+func AppliedPolicyViewModel(sources []policy.PolicySource) []AppliedPolicy {
+	res := make([]AppliedPolicy, 0, len(sources))
+	for _, v := range sources {
+		res = append(res, AppliedPolicy{
+			Engine:    v.Engine,
+			Tier:      v.Tier,
+			Name:      v.Name,
+			Namespace: v.Namespace,
+		})
+	}
+	return res
+}
+
+type ExternalPeer struct {
+	Cidrs    []string        `json:"cidrs"`
+	Ports    []PortInfo      `json:"ports"`
+	Policies []AppliedPolicy `json:"policies"`
+}
+
+func ExternalPeerViewModel(peers []policy.ExternalPeer) []ExternalPeer {
+	res := make([]ExternalPeer, 0, len(peers))
+	for _, v := range peers {
+		res = append(res, ExternalPeer{
+			Cidrs:    v.CIDRs,
+			Ports:    Cast2PortInfoList(v.Ports),
+			Policies: AppliedPolicyViewModel(v.Policies),
+		})
+	}
+	return res
+}
+
+type Warning struct {
+	Kind       string `json:"kind"`
+	PolicyName string `json:"policy_name"`
+	Namespace  string `json:"namespace"`
+	Code       string `json:"code"`
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+}
+
+func WarningViewModel(warnings []policy.Warning) []Warning {
+	res := make([]Warning, 0, len(warnings))
+	for _, w := range warnings {
+		res = append(res, Warning{
+			Kind:       w.Kind,
+			PolicyName: w.PolicyName,
+			Namespace:  w.Namespace,
+			Code:       w.Code,
+			Field:      w.Field,
+			Message:    w.Message,
+		})
+	}
+	return res
 }
 
 type Label struct {
@@ -34,71 +128,107 @@ func LabelViewModel(pod v1.Pod) []Label {
 type AccessPod struct {
 	Name      string    `json:"name"`
 	Ip        string    `json:"ip"`
+	Ips       []string  `json:"ips"`
 	Namespace string    `json:"namespace"`
+	State     string    `json:"state"`
 	Labels    []Label   `json:"labels"`
 	Ingress   PodPolicy `json:"ingress"`
 	Egress    PodPolicy `json:"egress"`
 }
 
-type PodPolicy struct {
-	CanAccess bool       `json:"can_access"`
-	Ports     []PortInfo `json:"ports"`
+func AccessPodViewModel(peer policy.PeerResult) AccessPod {
+	return AccessPod{
+		Name:      peer.Pod.Name,
+		Ip:        peer.Pod.Status.PodIP,
+		Ips:       policy.GetPodIPs(peer.Pod),
+		Namespace: peer.Pod.Namespace,
+		State:     string(policy.ClassifyPod(peer.Pod)),
+		Labels:    LabelViewModel(peer.Pod),
+		Ingress:   PodPolicyViewModel(peer.Ingress),
+		Egress:    PodPolicyViewModel(peer.Egress),
+	}
 }
 
-type PortRealInfo struct {
-	Protocol string
-	Port     int
-	EndPort  int
+type PodPolicy struct {
+	CanAccess    bool          `json:"can_access"`
+	Ports        []PortInfo    `json:"ports"`
+	Explanations []Explanation `json:"explanations"`
+	// アドレスファミリーによって結果が異なる場合のみファミリーごとの結果が入る
+	Families []FamilyPolicy `json:"families"`
 }
 
-type PortInfo struct {
-	Protocol *interface{} `json:"protocol"`
-	Port     *interface{} `json:"port"`
-	EndPort  *interface{} `json:"end_port"`
-}
+func PodPolicyViewModel(access policy.Access) PodPolicy {
+	families := make([]FamilyPolicy, 0, len(access.Families))
+	for _, v := range access.Families {
+		families = append(families, FamilyPolicy{
+			Family:       v.Family,
+			CanAccess:    v.Allowed,
+			Ports:        Cast2PortInfoList(v.Ports),
+			Explanations: ExplanationViewModel(v.Explanations),
+		})
+	}
 
-func Cast2PortRealInfo(port netv1.NetworkPolicyPort) PortRealInfo {
-	return PortRealInfo{
-		Protocol: CastProtocol(port.Protocol),
-		Port:     CastPort(port.Port),
-		EndPort:  CastEndPort(port.EndPort),
+	return PodPolicy{
+		CanAccess:    access.Allowed,
+		Ports:        Cast2PortInfoList(access.Ports),
+		Explanations: ExplanationViewModel(access.Explanations),
+		Families:     families,
 	}
 }
 
-func CastProtocol(protocol *v1.Protocol) string {
-	if protocol == nil {
-		return "any"
-	}
+type FamilyPolicy struct {
+	Family       string        `json:"family"`
+	CanAccess    bool          `json:"can_access"`
+	Ports        []PortInfo    `json:"ports"`
+	Explanations []Explanation `json:"explanations"`
+}
 
-	switch *protocol {
-	case v1.ProtocolTCP:
-		return "TCP"
-	case v1.ProtocolUDP:
-		return "UDP"
-	case v1.ProtocolSCTP:
-		return "SCTP"
-	default:
-		return "any"
-	}
+type Explanation struct {
+	Direction       string `json:"direction"`
+	Engine          string `json:"engine"`
+	Tier            string `json:"tier"`
+	PolicyName      string `json:"policy_name"`
+	PolicyNamespace string `json:"policy_namespace"`
+	RuleIndex       *int   `json:"rule_index"`
+	PeerIndex       *int   `json:"peer_index"`
+	PeerType        string `json:"peer_type"`
+	Reason          string `json:"reason"`
 }
 
-func CastPort(port *intstr.IntOrString) int {
-	if port == nil {
-		return 0
+func ExplanationViewModel(explanations []policy.Explanation) []Explanation {
+	res := make([]Explanation, 0, len(explanations))
+	for _, e := range explanations {
+		res = append(res, Explanation{
+			Direction:       string(e.Direction),
+			Engine:          e.Engine,
+			Tier:            e.Tier,
+			PolicyName:      e.PolicyName,
+			PolicyNamespace: e.PolicyNamespace,
+			RuleIndex:       castIndex(e.RuleIndex),
+			PeerIndex:       castIndex(e.PeerIndex),
+			PeerType:        e.PeerType,
+			Reason:          string(e.Reason),
+		})
 	}
-
-	return int(port.IntVal)
+	return res
 }
 
-func CastEndPort(endPort *int32) int {
-	if endPort == nil {
-		return 0
+// 該当しないインデックス(-1)はnullにする
+func castIndex(index int) *int {
+	if index < 0 {
+		return nil
 	}
+	return &index
+}
 
-	return int(*endPort)
+type PortInfo struct {
+	Protocol *interface{} `json:"protocol"`
+	Port     *interface{} `json:"port"`
+	EndPort  *interface{} `json:"end_port"`
+	PortName *interface{} `json:"port_name"`
 }
 
-func Cast2PortInfo(info PortRealInfo) PortInfo {
+func Cast2PortInfo(info policy.Port) PortInfo {
 	var res PortInfo
 
 	// protocol
@@ -123,10 +253,17 @@ func Cast2PortInfo(info PortRealInfo) PortInfo {
 		res.EndPort = &endPort
 	}
 
+	// 名前付きポートの場合は解決前の名前
+	if info.Name != "" {
+		var portName interface{}
+		portName = info.Name
+		res.PortName = &portName
+	}
+
 	return res
 }
 
-func Cast2PortInfoList(realInfoList []PortRealInfo) []PortInfo {
+func Cast2PortInfoList(realInfoList []policy.Port) []PortInfo {
 	if len(realInfoList) == 0 {
 		return nil
 	}
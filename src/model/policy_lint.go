@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+)
+
+type PolicyLintViewModel struct {
+	TotalFinding int       `json:"total_finding"`
+	Errors       int       `json:"errors"`
+	Warnings     int       `json:"warnings"`
+	Infos        int       `json:"infos"`
+	Findings     []Finding `json:"findings"`
+}
+
+type Finding struct {
+	Severity   string `json:"severity"`
+	Code       string `json:"code"`
+	PolicyName string `json:"policy_name"`
+	Namespace  string `json:"namespace"`
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+}
+
+func PolicyLint(findings []policy.Finding) PolicyLintViewModel {
+	res := PolicyLintViewModel{
+		TotalFinding: len(findings),
+		Findings:     make([]Finding, 0, len(findings)),
+	}
+	for _, f := range findings {
+		switch f.Severity {
+		case policy.SeverityError:
+			res.Errors++
+		case policy.SeverityWarning:
+			res.Warnings++
+		case policy.SeverityInfo:
+			res.Infos++
+		}
+		res.Findings = append(res.Findings, Finding{
+			Severity:   string(f.Severity),
+			Code:       f.Code,
+			PolicyName: f.PolicyName,
+			Namespace:  f.Namespace,
+			Field:      f.Field,
+			Message:    f.Message,
+		})
+	}
+	return res
+}
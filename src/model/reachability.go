@@ -0,0 +1,62 @@
+package model
+
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	v1 "k8s.io/api/core/v1"
+)
+
+type ReachabilityViewModel struct {
+	From         PodRef        `json:"from"`
+	To           PodRef        `json:"to"`
+	Protocol     string        `json:"protocol"`
+	Port         *int          `json:"port"`
+	Allowed      bool          `json:"allowed"`
+	Ports        []PortInfo    `json:"ports"`
+	Explanations []Explanation `json:"explanations"`
+	// アドレスファミリーによって結果が異なる場合のみファミリーごとの結果が入る
+	Families []FamilyReachability `json:"families"`
+}
+
+type FamilyReachability struct {
+	Family       string        `json:"family"`
+	Allowed      bool          `json:"allowed"`
+	Ports        []PortInfo    `json:"ports"`
+	Explanations []Explanation `json:"explanations"`
+}
+
+type PodRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+func PodRefViewModel(pod v1.Pod) PodRef {
+	return PodRef{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+	}
+}
+
+func Reachability(fromPod v1.Pod, toPod v1.Pod, protocol string, port int, access policy.Access) ReachabilityViewModel {
+	res := ReachabilityViewModel{
+		From:         PodRefViewModel(fromPod),
+		To:           PodRefViewModel(toPod),
+		Protocol:     protocol,
+		Allowed:      access.AllowsPort(protocol, port),
+		Ports:        Cast2PortInfoList(access.Ports),
+		Explanations: ExplanationViewModel(access.Explanations),
+		Families:     make([]FamilyReachability, 0, len(access.Families)),
+	}
+	for _, v := range access.Families {
+		familyAccess := policy.Access{Allowed: v.Allowed, Ports: v.Ports}
+		res.Families = append(res.Families, FamilyReachability{
+			Family:       v.Family,
+			Allowed:      familyAccess.AllowsPort(protocol, port),
+			Ports:        Cast2PortInfoList(v.Ports),
+			Explanations: ExplanationViewModel(v.Explanations),
+		})
+	}
+	if port != 0 {
+		res.Port = &port
+	}
+	return res
+}
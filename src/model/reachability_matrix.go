@@ -0,0 +1,99 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"sort"
+	"strings"
+)
+
+const (
+	MatrixEncodingSparse = "sparse"
+	MatrixEncodingBitset = "bitset"
+)
+
+type ReachabilityMatrixViewModel struct {
+	Encoding string   `json:"encoding"`
+	Pods     []PodRef `json:"pods"`
+	// 同じポート集合は一つにまとめ，cellからはインデックスで参照する．全ポートはprotocol, portがnullの一つ
+	PortSets [][]PortInfo `json:"port_sets"`
+	// sparse: 許可されている組のみ
+	Cells []MatrixCell `json:"cells,omitempty"`
+	// bitset: 通信元Podごとに，通信先Podのインデックス番目のbitが立ったビット列(base64)
+	Rows []string `json:"rows,omitempty"`
+	// bitset: 通信元Podごとに，許可されている通信先の昇順にport_setsのインデックスを並べたもの
+	RowPortSets [][]int `json:"row_port_sets,omitempty"`
+}
+
+type MatrixCell struct {
+	From    int `json:"from"`
+	To      int `json:"to"`
+	PortSet int `json:"port_set"`
+}
+
+func ReachabilityMatrix(matrix policy.Matrix, encoding string) ReachabilityMatrixViewModel {
+	res := ReachabilityMatrixViewModel{
+		Encoding: encoding,
+		Pods:     make([]PodRef, 0, len(matrix.Pods)),
+		PortSets: make([][]PortInfo, 0),
+	}
+	for _, pod := range matrix.Pods {
+		res.Pods = append(res.Pods, PodRefViewModel(pod))
+	}
+
+	portSetIndexMap := make(map[string]int)
+	getPortSetIndex := func(ports []policy.Port) int {
+		key := portSetKey(ports)
+		if i, ok := portSetIndexMap[key]; ok {
+			return i
+		}
+		portSet := Cast2PortInfoList(ports)
+		if portSet == nil {
+			portSet = []PortInfo{}
+		}
+		res.PortSets = append(res.PortSets, portSet)
+		portSetIndexMap[key] = len(res.PortSets) - 1
+		return len(res.PortSets) - 1
+	}
+
+	switch encoding {
+	case MatrixEncodingBitset:
+		bitsets := make([][]byte, len(matrix.Pods))
+		res.RowPortSets = make([][]int, len(matrix.Pods))
+		for i := range bitsets {
+			bitsets[i] = make([]byte, (len(matrix.Pods)+7)/8)
+			res.RowPortSets[i] = make([]int, 0)
+		}
+		// cellsは通信元，通信先の昇順に並んでいる
+		for _, cell := range matrix.Cells {
+			bitsets[cell.From][cell.To/8] |= 1 << (cell.To % 8)
+			res.RowPortSets[cell.From] = append(res.RowPortSets[cell.From], getPortSetIndex(cell.Ports))
+		}
+		res.Rows = make([]string, 0, len(bitsets))
+		for _, b := range bitsets {
+			res.Rows = append(res.Rows, base64.StdEncoding.EncodeToString(b))
+		}
+	default:
+		res.Cells = make([]MatrixCell, 0, len(matrix.Cells))
+		for _, cell := range matrix.Cells {
+			res.Cells = append(res.Cells, MatrixCell{
+				From:    cell.From,
+				To:      cell.To,
+				PortSet: getPortSetIndex(cell.Ports),
+			})
+		}
+	}
+
+	return res
+}
+
+// ポートの並び順によらない集合のキー
+func portSetKey(ports []policy.Port) string {
+	keys := make([]string, 0, len(ports))
+	for _, p := range ports {
+		keys = append(keys, fmt.Sprintf("%s/%d-%d/%s", p.Protocol, p.Port, p.EndPort, p.Name))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"strconv"
+)
+
+type ServiceListViewModel struct {
+	TotalService int                `json:"total_service"`
+	Services     []ServiceViewModel `json:"services"`
+}
+
+type ServiceViewModel struct {
+	Name       string        `json:"name"`
+	Namespace  string        `json:"namespace"`
+	Type       string        `json:"type"`
+	ClusterIps []string      `json:"cluster_ips"`
+	Selector   []Label       `json:"selector"`
+	Ports      []ServicePort `json:"ports"`
+	// EndpointSliceに登録されているPodの数
+	TotalBackend int `json:"total_backend"`
+}
+
+type ServicePort struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port"`
+	// 数値または名前付きポート
+	TargetPort string `json:"target_port"`
+}
+
+type ServiceDetailViewModel struct {
+	ServiceViewModel
+	// 通信可否を判定したクライアントのPod．指定がない場合はnull
+	Client   *PodRef          `json:"client"`
+	Backends []ServiceBackend `json:"backends"`
+}
+
+type ServiceBackend struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	Ips       []string      `json:"ips"`
+	Ready     bool          `json:"ready"`
+	State     string        `json:"state"`
+	Ports     []BackendPort `json:"ports"`
+}
+
+// BackendPort はServiceのポートがバックエンドのPodのどのポートに転送されるか
+type BackendPort struct {
+	Name       string `json:"name"`
+	Protocol   string `json:"protocol"`
+	Port       int    `json:"port"`
+	TargetPort int    `json:"target_port"`
+	// クライアントのPodからこのポートで通信できるか．クライアントの指定がない場合はnull
+	Reachable *bool `json:"reachable"`
+}
+
+// Service はServiceとEndpointSliceから一覧用のViewModelを作る
+func Service(service v1.Service, slices []discoveryv1.EndpointSlice) ServiceViewModel {
+	selector := make([]Label, 0, len(service.Spec.Selector))
+	for k, v := range service.Spec.Selector {
+		selector = append(selector, Label{Key: k, Value: v})
+	}
+	ports := make([]ServicePort, 0, len(service.Spec.Ports))
+	for _, p := range service.Spec.Ports {
+		ports = append(ports, ServicePort{
+			Name:       p.Name,
+			Protocol:   castServiceProtocol(p.Protocol),
+			Port:       int(p.Port),
+			TargetPort: getTargetPort(p),
+		})
+	}
+	clusterIps := service.Spec.ClusterIPs
+	if len(clusterIps) == 0 && service.Spec.ClusterIP != "" {
+		clusterIps = []string{service.Spec.ClusterIP}
+	}
+
+	return ServiceViewModel{
+		Name:         service.Name,
+		Namespace:    service.Namespace,
+		Type:         string(service.Spec.Type),
+		ClusterIps:   clusterIps,
+		Selector:     selector,
+		Ports:        ports,
+		TotalBackend: len(ServiceBackends(service, slices, nil, nil, nil)),
+	}
+}
+
+// ServiceDetail はServiceのバックエンドと，clientが指定されていればclientから各バックエンドへの通信可否を返す．
+// accessesはバックエンドのPodの"namespace/name"をキーとしたclientからの通信可否
+func ServiceDetail(service v1.Service, slices []discoveryv1.EndpointSlice, pods map[string]v1.Pod, client *v1.Pod, accesses map[string]policy.Access) ServiceDetailViewModel {
+	res := ServiceDetailViewModel{
+		ServiceViewModel: Service(service, slices),
+		Backends:         ServiceBackends(service, slices, pods, client, accesses),
+	}
+	if client != nil {
+		ref := PodRefViewModel(*client)
+		res.Client = &ref
+	}
+	return res
+}
+
+// ServiceBackends はEndpointSliceからバックエンドの一覧を作る．デュアルスタックではファミリーごとのEndpointSliceに同じPodが現れるのでまとめる
+func ServiceBackends(service v1.Service, slices []discoveryv1.EndpointSlice, pods map[string]v1.Pod, client *v1.Pod, accesses map[string]policy.Access) []ServiceBackend {
+	res := make([]ServiceBackend, 0)
+	indexes := make(map[string]int)
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			key := ""
+			backend := ServiceBackend{Namespace: service.Namespace, Ips: []string{}}
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				backend.Name = endpoint.TargetRef.Name
+				backend.Namespace = endpoint.TargetRef.Namespace
+				key = backend.Namespace + "/" + backend.Name
+			} else if len(endpoint.Addresses) != 0 {
+				// Podに紐づかないエンドポイントはアドレスで区別する
+				key = endpoint.Addresses[0]
+			}
+			if i, ok := indexes[key]; ok {
+				res[i].Ips = append(res[i].Ips, endpoint.Addresses...)
+				continue
+			}
+
+			backend.Ips = append(backend.Ips, endpoint.Addresses...)
+			// readyが省略されている場合はreadyとして扱う
+			backend.Ready = endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+			pod, hasPod := pods[key]
+			if hasPod {
+				backend.State = string(policy.ClassifyPod(pod))
+			}
+			access, hasAccess := accesses[key]
+
+			backend.Ports = make([]BackendPort, 0, len(service.Spec.Ports))
+			for _, servicePort := range service.Spec.Ports {
+				targetPort, ok := getSlicePort(slice, servicePort)
+				if !ok {
+					continue
+				}
+				port := BackendPort{
+					Name:       servicePort.Name,
+					Protocol:   castServiceProtocol(servicePort.Protocol),
+					Port:       int(servicePort.Port),
+					TargetPort: targetPort,
+				}
+				if client != nil {
+					// バックエンドのPodが見つからない場合は判定できないので通信不可とする
+					reachable := hasAccess && access.AllowsPort(port.Protocol, targetPort)
+					port.Reachable = &reachable
+				}
+				backend.Ports = append(backend.Ports, port)
+			}
+
+			indexes[key] = len(res)
+			res = append(res, backend)
+		}
+	}
+	return res
+}
+
+// Serviceのポートに対応するEndpointSliceのポート番号を返す．名前付きのtargetPortはPodごとに解決された番号が入っている
+func getSlicePort(slice discoveryv1.EndpointSlice, servicePort v1.ServicePort) (int, bool) {
+	for _, p := range slice.Ports {
+		name := ""
+		if p.Name != nil {
+			name = *p.Name
+		}
+		protocol := v1.ProtocolTCP
+		if p.Protocol != nil {
+			protocol = *p.Protocol
+		}
+		if name == servicePort.Name && string(protocol) == castServiceProtocol(servicePort.Protocol) && p.Port != nil {
+			return int(*p.Port), true
+		}
+	}
+	return 0, false
+}
+
+func getTargetPort(port v1.ServicePort) string {
+	if port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal == 0 {
+		// targetPortの省略時はportと同じ
+		return strconv.Itoa(int(port.Port))
+	}
+	return port.TargetPort.String()
+}
+
+func castServiceProtocol(protocol v1.Protocol) string {
+	if protocol == "" {
+		return string(v1.ProtocolTCP)
+	}
+	return string(protocol)
+}
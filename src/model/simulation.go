@@ -0,0 +1,84 @@
+package model
+
+import (
+	"github.com/asuyasuya/k8s-vis-backend/src/policy"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type SimulationViewModel struct {
+	Added            []PolicyRef       `json:"added"`
+	Replaced         []PolicyRef       `json:"replaced"`
+	Deleted          []PolicyRef       `json:"deleted"`
+	NotFound         []PolicyRef       `json:"not_found"`
+	NewlyAllowed     []FlowChange      `json:"newly_allowed"`
+	NewlyDenied      []FlowChange      `json:"newly_denied"`
+	IsolationChanges []IsolationChange `json:"isolation_changes"`
+	Warnings         []Warning         `json:"warnings"`
+}
+
+type PolicyRef struct {
+	// CRDのpolicyの場合の種類(GlobalNetworkPolicy, CiliumNetworkPolicy, Tier等)
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type FlowChange struct {
+	From  PodRef     `json:"from"`
+	To    PodRef     `json:"to"`
+	Ports []PortInfo `json:"ports"`
+}
+
+type IsolationChange struct {
+	Pod       PodRef `json:"pod"`
+	Direction string `json:"direction"`
+	Isolated  bool   `json:"isolated"`
+}
+
+func Simulation(result policy.SimulationResult) SimulationViewModel {
+	return SimulationViewModel{
+		Added:            PolicyRefViewModel(result.Overlay.Added),
+		Replaced:         PolicyRefViewModel(result.Overlay.Replaced),
+		Deleted:          PolicyRefViewModel(result.Overlay.Deleted),
+		NotFound:         PolicyRefViewModel(result.Overlay.NotFound),
+		NewlyAllowed:     FlowChangeViewModel(result.NewlyAllowed),
+		NewlyDenied:      FlowChangeViewModel(result.NewlyDenied),
+		IsolationChanges: IsolationChangeViewModel(result.IsolationChanges),
+		Warnings:         WarningViewModel(result.Warnings),
+	}
+}
+
+func PolicyRefViewModel(keys []types.NamespacedName) []PolicyRef {
+	res := make([]PolicyRef, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, PolicyRef{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		})
+	}
+	return res
+}
+
+func FlowChangeViewModel(changes []policy.FlowChange) []FlowChange {
+	res := make([]FlowChange, 0, len(changes))
+	for _, c := range changes {
+		res = append(res, FlowChange{
+			From:  PodRefViewModel(c.From),
+			To:    PodRefViewModel(c.To),
+			Ports: Cast2PortInfoList(c.Ports),
+		})
+	}
+	return res
+}
+
+func IsolationChangeViewModel(changes []policy.IsolationChange) []IsolationChange {
+	res := make([]IsolationChange, 0, len(changes))
+	for _, c := range changes {
+		res = append(res, IsolationChange{
+			Pod:       PodRefViewModel(c.Pod),
+			Direction: string(c.Direction),
+			Isolated:  c.Isolated,
+		})
+	}
+	return res
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"reflect"
+	"time"
+)
+
+// /api/watchで送るイベントの種類
+const (
+	WatchEventPodAdded         = "pod_added"
+	WatchEventPodDeleted       = "pod_deleted"
+	WatchEventPodScheduled     = "pod_scheduled"
+	WatchEventPodMoved         = "pod_moved"
+	WatchEventPodUpdated       = "pod_updated"
+	WatchEventNodeAdded        = "node_added"
+	WatchEventNodeRemoved      = "node_removed"
+	WatchEventNamespaceChanged = "namespace_changed"
+	WatchEventPolicyChanged    = "policy_changed"
+	// ?pod=で購読したPodの通信可否．最初は全ての通信相手，以降は変化したものだけを送る
+	WatchEventReachability        = "reachability"
+	WatchEventReachabilityChanged = "reachability_changed"
+	// 送信が追いつかずイベントを取りこぼしたので，クライアントは一覧を取得し直す必要がある
+	WatchEventResync = "resync"
+)
+
+type WatchEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Podのイベントでは所属するノード，ノードのイベントではそのノード
+	Node string `json:"node,omitempty"`
+	// pod_movedの移動元のノード
+	PreviousNode string        `json:"previous_node,omitempty"`
+	Pod          *PodViewModel `json:"pod,omitempty"`
+	Namespace    string        `json:"namespace,omitempty"`
+	Policy       *PolicyRef    `json:"policy,omitempty"`
+	// pod_updatedで変化した項目(labels, state, ips)
+	Changes      []string          `json:"changes,omitempty"`
+	Reachability *ReachabilityDiff `json:"reachability,omitempty"`
+}
+
+// ReachabilityDiff は購読しているPodと各Podとの通信可否のうち，前回から変化したもの
+type ReachabilityDiff struct {
+	Target PodRef `json:"target"`
+	// 追加された，または通信可否が変化した通信相手
+	Changed []AccessPod `json:"changed"`
+	// いなくなった通信相手
+	Removed []PodRef `json:"removed"`
+}
+
+func (d ReachabilityDiff) IsEmpty() bool {
+	return len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// DiffAccessPods はbeforeからafterへの通信可否の変化を求める．理由の説明だけが変わったものは含めない
+func DiffAccessPods(target PodRef, before []AccessPod, after []AccessPod) ReachabilityDiff {
+	res := ReachabilityDiff{Target: target, Changed: make([]AccessPod, 0), Removed: make([]PodRef, 0)}
+	beforeMap := make(map[PodRef]AccessPod, len(before))
+	for _, v := range before {
+		beforeMap[PodRef{Name: v.Name, Namespace: v.Namespace}] = v
+	}
+
+	for _, v := range after {
+		key := PodRef{Name: v.Name, Namespace: v.Namespace}
+		prev, ok := beforeMap[key]
+		delete(beforeMap, key)
+		if ok && isSameAccess(prev.Ingress, v.Ingress) && isSameAccess(prev.Egress, v.Egress) &&
+			prev.State == v.State && reflect.DeepEqual(prev.Ips, v.Ips) {
+			continue
+		}
+		res.Changed = append(res.Changed, v)
+	}
+	for _, v := range before {
+		key := PodRef{Name: v.Name, Namespace: v.Namespace}
+		if _, ok := beforeMap[key]; ok {
+			res.Removed = append(res.Removed, key)
+		}
+	}
+	return res
+}
+
+func isSameAccess(a PodPolicy, b PodPolicy) bool {
+	if a.CanAccess != b.CanAccess || !reflect.DeepEqual(a.Ports, b.Ports) || len(a.Families) != len(b.Families) {
+		return false
+	}
+	for i := range a.Families {
+		if a.Families[i].Family != b.Families[i].Family || a.Families[i].CanAccess != b.Families[i].CanAccess ||
+			!reflect.DeepEqual(a.Families[i].Ports, b.Families[i].Ports) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,280 @@
+package policy
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"math"
+	"net"
+)
+
+// AdminNetworkPolicyはNetwork Policyより前，BaselineAdminNetworkPolicyは後に評価する層になる
+const (
+	adminTierName    = "admin"
+	baselineTierName = "baseline"
+	adminTierOrder   = -math.MaxFloat64
+)
+
+// AdminNetworkPolicy はpolicy.networking.k8s.ioのAdminNetworkPolicy, BaselineAdminNetworkPolicy．
+// BaselineAdminNetworkPolicyはpriorityを持たず，Passは使えない
+type AdminNetworkPolicy struct {
+	Name string
+	Spec AdminNetworkPolicySpec
+}
+
+type AdminNetworkPolicySpec struct {
+	// 小さいほど先に評価する
+	Priority int32                     `json:"priority,omitempty"`
+	Subject  AdminNetworkPolicySubject `json:"subject"`
+	Ingress  []AdminNetworkPolicyRule  `json:"ingress,omitempty"`
+	Egress   []AdminNetworkPolicyRule  `json:"egress,omitempty"`
+}
+
+// AdminNetworkPolicySubject はpolicyが適用されるPod．namespaces, podsのどちらか一方を指定する
+type AdminNetworkPolicySubject struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+}
+
+type NamespacedPod struct {
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	PodSelector       metav1.LabelSelector `json:"podSelector"`
+}
+
+type AdminNetworkPolicyRule struct {
+	Name   string `json:"name,omitempty"`
+	Action string `json:"action"`
+	// ingressではfrom，egressではtoに指定された通信相手
+	From  []AdminNetworkPolicyPeer  `json:"from,omitempty"`
+	To    []AdminNetworkPolicyPeer  `json:"to,omitempty"`
+	Ports *[]AdminNetworkPolicyPort `json:"ports,omitempty"`
+}
+
+type AdminNetworkPolicyPeer struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+	// nodes, networksはegressのみ
+	Nodes    *metav1.LabelSelector `json:"nodes,omitempty"`
+	Networks []string              `json:"networks,omitempty"`
+}
+
+type AdminNetworkPolicyPort struct {
+	PortNumber *struct {
+		Protocol string `json:"protocol"`
+		Port     int32  `json:"port"`
+	} `json:"portNumber,omitempty"`
+	NamedPort *string `json:"namedPort,omitempty"`
+	PortRange *struct {
+		Protocol string `json:"protocol"`
+		Start    int32  `json:"start"`
+		End      int32  `json:"end"`
+	} `json:"portRange,omitempty"`
+}
+
+// NewAdminNetworkPolicy はdynamic clientで取得したAdminNetworkPolicy, BaselineAdminNetworkPolicyを変換する
+func NewAdminNetworkPolicy(obj unstructured.Unstructured) (AdminNetworkPolicy, error) {
+	res := AdminNetworkPolicy{Name: obj.GetName()}
+	if err := convertUnstructuredSpec(obj, &res.Spec); err != nil {
+		return AdminNetworkPolicy{}, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return res, nil
+}
+
+// AdminNetworkPolicy, BaselineAdminNetworkPolicyを評価用に変換する．どちらもルールにマッチしなかった通信は次の層で評価する
+func compileAdminNetworkPolicy(policy AdminNetworkPolicy, baseline bool) (*compiledPolicy, []Warning) {
+	kind := "AdminNetworkPolicy"
+	if baseline {
+		kind = "BaselineAdminNetworkPolicy"
+	}
+	warnings := make([]Warning, 0)
+	addWarning := func(code string, field string, err error) {
+		warnings = append(warnings, Warning{
+			Kind:       kind,
+			PolicyName: policy.Name,
+			Code:       code,
+			Field:      field,
+			Message:    err.Error(),
+		})
+	}
+	validateSelector := func(field string, selector *metav1.LabelSelector) {
+		if err := validateLabelSelector(selector); err != nil {
+			addWarning(WarningCodeInvalidSelector, field, err)
+		}
+	}
+	validateNamespacedPod := func(field string, pods *NamespacedPod) {
+		if pods == nil {
+			return
+		}
+		validateSelector(field+".namespaceSelector", &pods.NamespaceSelector)
+		validateSelector(field+".podSelector", &pods.PodSelector)
+	}
+
+	tier, order := adminTierName, float64(policy.Spec.Priority)
+	if baseline {
+		tier, order = baselineTierName, 0
+	}
+
+	subject := policy.Spec.Subject
+	validateSelector("spec.subject.namespaces", subject.Namespaces)
+	validateNamespacedPod("spec.subject.pods", subject.Pods)
+	res := &compiledPolicy{
+		source: PolicySource{
+			Engine: EngineKubernetes,
+			Tier:   tier,
+			Name:   policy.Name,
+		},
+		order: order,
+		selects: func(self endpoint) bool {
+			return isIncludedInAdminNetworkPolicyPeer(self, AdminNetworkPolicyPeer{Namespaces: subject.Namespaces, Pods: subject.Pods})
+		},
+		hasIngress: len(policy.Spec.Ingress) != 0,
+		hasEgress:  len(policy.Spec.Egress) != 0,
+	}
+
+	compileRules := func(field string, rules []AdminNetworkPolicyRule, direction Direction) []compiledRule {
+		res := make([]compiledRule, 0, len(rules))
+		for i, rule := range rules {
+			ruleField := fmt.Sprintf("%s[%d]", field, i)
+			switch {
+			case rule.Action == string(ActionAllow) || rule.Action == string(ActionDeny):
+			case rule.Action == string(ActionPass) && !baseline:
+			default:
+				addWarning(WarningCodeInvalidAction, ruleField+".action", fmt.Errorf("unsupported action %q", rule.Action))
+				continue
+			}
+
+			peers, peerField := rule.From, ruleField+".from"
+			if direction == DirectionEgress {
+				peers, peerField = rule.To, ruleField+".to"
+			}
+			for j, peer := range peers {
+				validateSelector(fmt.Sprintf("%s[%d].namespaces", peerField, j), peer.Namespaces)
+				validateNamespacedPod(fmt.Sprintf("%s[%d].pods", peerField, j), peer.Pods)
+				validateSelector(fmt.Sprintf("%s[%d].nodes", peerField, j), peer.Nodes)
+				for k, network := range peer.Networks {
+					if _, _, err := net.ParseCIDR(network); err != nil {
+						addWarning(WarningCodeInvalidCIDR, fmt.Sprintf("%s[%d].networks[%d]", peerField, j, k), err)
+					}
+				}
+			}
+
+			ports := compileAdminNetworkPolicyPorts(ruleField+".ports", rule.Ports, addWarning)
+			externalRanges := make([]ipRange, 0)
+			for _, peer := range peers {
+				externalRanges = append(externalRanges, cidrsToRanges(peer.Networks, nil)...)
+			}
+			res = append(res, compiledRule{
+				externalRanges: externalRanges,
+				index:          i,
+				action:         Action(rule.Action),
+				match: func(self endpoint, peer endpoint) (bool, int, string) {
+					// from, toはOR条件
+					for j, v := range peers {
+						if isIncludedInAdminNetworkPolicyPeer(peer, v) {
+							return true, j, getAdminNetworkPolicyPeerType(v)
+						}
+					}
+					return false, -1, ""
+				},
+				ports: ports,
+			})
+		}
+		return res
+	}
+	res.ingress = compileRules("spec.ingress", policy.Spec.Ingress, DirectionIngress)
+	res.egress = compileRules("spec.egress", policy.Spec.Egress, DirectionEgress)
+
+	if len(warnings) != 0 {
+		return nil, warnings
+	}
+	return res, nil
+}
+
+// peerがnamespaces, pods, networksのいずれかにマッチするか．nodesはPodにはマッチしない
+func isIncludedInAdminNetworkPolicyPeer(ep endpoint, peer AdminNetworkPolicyPeer) bool {
+	switch {
+	case peer.Namespaces != nil:
+		return isIncludedInLabelSelector(ep.namespace.Labels, peer.Namespaces)
+	case peer.Pods != nil:
+		return isIncludedInLabelSelector(ep.namespace.Labels, &peer.Pods.NamespaceSelector) &&
+			isIncludedInLabelSelector(ep.pod.Labels, &peer.Pods.PodSelector)
+	case len(peer.Networks) != 0:
+		for _, network := range peer.Networks {
+			if ok, _ := isAnyIncludedInIpBlock(&netv1.IPBlock{CIDR: network}, ep.ips); ok {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func getAdminNetworkPolicyPeerType(peer AdminNetworkPolicyPeer) string {
+	switch {
+	case peer.Namespaces != nil:
+		return "namespaces"
+	case peer.Pods != nil:
+		return "pods"
+	case peer.Nodes != nil:
+		return "nodes"
+	default:
+		return "networks"
+	}
+}
+
+// ルールのポートを変換する．portsの指定がない場合は全ポート
+func compileAdminNetworkPolicyPorts(field string, ports *[]AdminNetworkPolicyPort, addWarning func(code string, field string, err error)) func(dest v1.Pod) PortSet {
+	if ports == nil {
+		return func(v1.Pod) PortSet { return AllPortSet() }
+	}
+
+	numbered := make([]Port, 0, len(*ports))
+	named := make([]string, 0)
+	for i, p := range *ports {
+		portField := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case p.PortNumber != nil:
+			numbered = append(numbered, Port{Protocol: p.PortNumber.Protocol, Port: int(p.PortNumber.Port)})
+		case p.PortRange != nil:
+			if p.PortRange.End < p.PortRange.Start {
+				addWarning(WarningCodeInvalidPort, portField+".portRange", fmt.Errorf("end %d is before start %d", p.PortRange.End, p.PortRange.Start))
+				continue
+			}
+			numbered = append(numbered, Port{Protocol: p.PortRange.Protocol, Port: int(p.PortRange.Start), EndPort: int(p.PortRange.End)})
+		case p.NamedPort != nil:
+			named = append(named, *p.NamedPort)
+		}
+	}
+	for i, p := range numbered {
+		// protocolの指定がない場合はTCPとして扱う
+		if p.Protocol == "" {
+			numbered[i].Protocol = "TCP"
+		}
+	}
+
+	return func(dest v1.Pod) PortSet {
+		res := append([]Port{}, numbered...)
+		// 名前付きポートはプロトコルに関係なく通信先のコンテナポートで解決する
+		for _, name := range named {
+			for _, container := range dest.Spec.Containers {
+				for _, containerPort := range container.Ports {
+					if containerPort.Name != name {
+						continue
+					}
+					protocol := string(containerPort.Protocol)
+					if protocol == "" {
+						protocol = "TCP"
+					}
+					res = append(res, Port{Protocol: protocol, Port: int(containerPort.ContainerPort), Name: name})
+				}
+			}
+		}
+		if len(res) == 0 {
+			return EmptyPortSet()
+		}
+		return NewPortSet(res)
+	}
+}
@@ -0,0 +1,459 @@
+package policy
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// CalicoPolicy はcrd.projectcalico.orgのNetworkPolicy, GlobalNetworkPolicy
+type CalicoPolicy struct {
+	Name      string
+	Namespace string
+	// GlobalNetworkPolicyならtrue
+	Global bool
+	Spec   CalicoPolicySpec
+}
+
+type CalicoPolicySpec struct {
+	Tier  string   `json:"tier,omitempty"`
+	Order *float64 `json:"order,omitempty"`
+	// selectorはPodを，namespaceSelectorはGlobalNetworkPolicyが適用されるnamespaceを選択する
+	Selector          string       `json:"selector,omitempty"`
+	NamespaceSelector string       `json:"namespaceSelector,omitempty"`
+	Types             []string     `json:"types,omitempty"`
+	Ingress           []CalicoRule `json:"ingress,omitempty"`
+	Egress            []CalicoRule `json:"egress,omitempty"`
+}
+
+type CalicoRule struct {
+	Action      string              `json:"action"`
+	Protocol    *intstr.IntOrString `json:"protocol,omitempty"`
+	NotProtocol *intstr.IntOrString `json:"notProtocol,omitempty"`
+	Source      CalicoEntityRule    `json:"source,omitempty"`
+	Destination CalicoEntityRule    `json:"destination,omitempty"`
+}
+
+type CalicoEntityRule struct {
+	Nets              []string             `json:"nets,omitempty"`
+	NotNets           []string             `json:"notNets,omitempty"`
+	Selector          string               `json:"selector,omitempty"`
+	NotSelector       string               `json:"notSelector,omitempty"`
+	NamespaceSelector string               `json:"namespaceSelector,omitempty"`
+	Ports             []intstr.IntOrString `json:"ports,omitempty"`
+	NotPorts          []intstr.IntOrString `json:"notPorts,omitempty"`
+}
+
+// CalicoTier はpolicyを評価する層．orderの小さい層から評価する
+type CalicoTier struct {
+	Name  string
+	Order *float64
+	// 層のpolicyにマッチしなかった通信の扱い(Deny, Pass)．省略時はDeny
+	DefaultAction string
+}
+
+// NewCalicoPolicy はdynamic clientで取得したNetworkPolicy, GlobalNetworkPolicyを変換する
+func NewCalicoPolicy(obj unstructured.Unstructured) (CalicoPolicy, error) {
+	res := CalicoPolicy{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		// GlobalNetworkPolicyはnamespaceに属さない
+		Global: obj.GetNamespace() == "",
+	}
+	if err := convertUnstructuredSpec(obj, &res.Spec); err != nil {
+		return CalicoPolicy{}, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return res, nil
+}
+
+func (p CalicoPolicy) kind() string {
+	if p.Global {
+		return "GlobalNetworkPolicy"
+	}
+	return "NetworkPolicy"
+}
+
+// NewCalicoTier はdynamic clientで取得したTierを変換する
+func NewCalicoTier(obj unstructured.Unstructured) (CalicoTier, error) {
+	spec := struct {
+		Order         *float64 `json:"order,omitempty"`
+		DefaultAction string   `json:"defaultAction,omitempty"`
+	}{}
+	if err := convertUnstructuredSpec(obj, &spec); err != nil {
+		return CalicoTier{}, fmt.Errorf("Tier %s: %w", obj.GetName(), err)
+	}
+	return CalicoTier{Name: obj.GetName(), Order: spec.Order, DefaultAction: spec.DefaultAction}, nil
+}
+
+// Calicoがselectorの評価に使うPodのラベル．Pod自身のラベルにnamespace等のラベルが加わる
+func calicoPodLabels(pod v1.Pod) map[string]string {
+	res := make(map[string]string, len(pod.Labels)+3)
+	for k, v := range pod.Labels {
+		res[k] = v
+	}
+	res["projectcalico.org/namespace"] = pod.Namespace
+	res["projectcalico.org/orchestrator"] = "k8s"
+	serviceAccount := pod.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	res["projectcalico.org/serviceaccount"] = serviceAccount
+	return res
+}
+
+func calicoNamespaceLabels(namespace v1.Namespace) map[string]string {
+	res := make(map[string]string, len(namespace.Labels)+1)
+	for k, v := range namespace.Labels {
+		res[k] = v
+	}
+	res["projectcalico.org/name"] = namespace.Name
+	return res
+}
+
+// Calicoのpolicyを評価用に変換する．評価できない記述がある場合は警告を返す
+func compileCalicoPolicy(policy CalicoPolicy) (*compiledPolicy, []Warning) {
+	warnings := make([]Warning, 0)
+	addWarning := func(code string, field string, err error) {
+		warnings = append(warnings, Warning{
+			Kind:       policy.kind(),
+			PolicyName: policy.Name,
+			Namespace:  policy.Namespace,
+			Code:       code,
+			Field:      field,
+			Message:    err.Error(),
+		})
+	}
+	parseSelector := func(field string, s string) calicoSelector {
+		selector, err := parseCalicoSelector(s)
+		if err != nil {
+			addWarning(WarningCodeInvalidSelector, field, err)
+		}
+		return selector
+	}
+
+	tier := policy.Spec.Tier
+	if tier == "" {
+		tier = defaultTierName
+	}
+	order := float64(unorderedPolicyOrder)
+	if policy.Spec.Order != nil {
+		order = *policy.Spec.Order
+	}
+
+	selector := parseSelector("spec.selector", policy.Spec.Selector)
+	namespaceSelector := parseSelector("spec.namespaceSelector", policy.Spec.NamespaceSelector)
+	types := getCalicoPolicyTypes(policy.Spec)
+	res := &compiledPolicy{
+		source: PolicySource{
+			Engine:    EngineCalico,
+			Tier:      tier,
+			Name:      policy.Name,
+			Namespace: policy.Namespace,
+		},
+		order: order,
+		selects: func(self endpoint) bool {
+			if !policy.Global && self.pod.Namespace != policy.Namespace {
+				return false
+			}
+			if policy.Global && !namespaceSelector(calicoNamespaceLabels(self.namespace)) {
+				return false
+			}
+			return selector(calicoPodLabels(self.pod))
+		},
+		hasIngress: hasCalicoType(types, "Ingress"),
+		hasEgress:  hasCalicoType(types, "Egress"),
+	}
+
+	compileRules := func(field string, rules []CalicoRule, direction Direction) []compiledRule {
+		res := make([]compiledRule, 0, len(rules))
+		for i, rule := range rules {
+			ruleField := fmt.Sprintf("%s[%d]", field, i)
+			switch rule.Action {
+			case "Allow", "Deny", "Pass":
+			case "Log":
+				// Logは通信の可否に影響しない
+				continue
+			default:
+				addWarning(WarningCodeInvalidAction, ruleField+".action", fmt.Errorf("unsupported action %q", rule.Action))
+				continue
+			}
+
+			source := compileCalicoEntityRule(ruleField+".source", rule.Source, policy, parseSelector, addWarning)
+			destination := compileCalicoEntityRule(ruleField+".destination", rule.Destination, policy, parseSelector, addWarning)
+			ports := compileCalicoPorts(ruleField, rule, addWarning)
+			peerRule := rule.Source
+			if direction == DirectionEgress {
+				peerRule = rule.Destination
+			}
+			res = append(res, compiledRule{
+				externalRanges: calicoExternalRanges(peerRule),
+				index:          i,
+				action:         Action(rule.Action),
+				match: func(self endpoint, peer endpoint) (bool, int, string) {
+					// ingressでは通信元がpeer，通信先が自身．egressでは逆
+					peerEntity, selfEntity := source, destination
+					if direction == DirectionEgress {
+						peerEntity, selfEntity = destination, source
+					}
+					if ok, _ := selfEntity(self); !ok {
+						return false, -1, ""
+					}
+					ok, peerType := peerEntity(peer)
+					return ok, -1, peerType
+				},
+				ports: ports,
+			})
+		}
+		return res
+	}
+	res.ingress = compileRules("spec.ingress", policy.Spec.Ingress, DirectionIngress)
+	res.egress = compileRules("spec.egress", policy.Spec.Egress, DirectionEgress)
+
+	if len(warnings) != 0 {
+		return nil, warnings
+	}
+	return res, nil
+}
+
+// 通信相手の条件がマッチするクラスター外のIPの範囲．selectorはPodのみを選択するので，selectorのある条件はクラスター外にマッチしない
+func calicoExternalRanges(entity CalicoEntityRule) []ipRange {
+	if entity.Selector != "" || entity.NotSelector != "" || entity.NamespaceSelector != "" {
+		return nil
+	}
+	if len(entity.Nets) == 0 {
+		return cidrsToRanges([]string{"0.0.0.0/0", "::/0"}, entity.NotNets)
+	}
+	return cidrsToRanges(entity.Nets, entity.NotNets)
+}
+
+// typesが省略されている場合，egressルールのみならEgress，両方あればIngress, Egress，それ以外はIngressとして扱う
+func getCalicoPolicyTypes(spec CalicoPolicySpec) []string {
+	if len(spec.Types) != 0 {
+		return spec.Types
+	}
+
+	switch {
+	case len(spec.Ingress) != 0 && len(spec.Egress) != 0:
+		return []string{"Ingress", "Egress"}
+	case len(spec.Egress) != 0:
+		return []string{"Egress"}
+	default:
+		return []string{"Ingress"}
+	}
+}
+
+func hasCalicoType(types []string, t string) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// source, destinationの条件を変換する．条件は全てAND条件で，マッチした場合は条件の種類を返す
+func compileCalicoEntityRule(
+	field string,
+	entity CalicoEntityRule,
+	policy CalicoPolicy,
+	parseSelector func(field string, s string) calicoSelector,
+	addWarning func(code string, field string, err error),
+) func(ep endpoint) (bool, string) {
+	parseNets := func(field string, nets []string) []*net.IPNet {
+		res := make([]*net.IPNet, 0, len(nets))
+		for i, v := range nets {
+			// 単一のIPも指定できる
+			if !strings.Contains(v, "/") {
+				if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+					v += "/32"
+				} else {
+					v += "/128"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(v)
+			if err != nil {
+				addWarning(WarningCodeInvalidCIDR, fmt.Sprintf("%s[%d]", field, i), err)
+				continue
+			}
+			res = append(res, ipNet)
+		}
+		return res
+	}
+	containsIP := func(nets []*net.IPNet, ips []string) bool {
+		for _, ip := range ips {
+			targetIP := net.ParseIP(ip)
+			for _, v := range nets {
+				if targetIP != nil && v.Contains(targetIP) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	nets := parseNets(field+".nets", entity.Nets)
+	notNets := parseNets(field+".notNets", entity.NotNets)
+	hasSelector := entity.Selector != "" || entity.NotSelector != ""
+	selector := parseSelector(field+".selector", entity.Selector)
+	var notSelector calicoSelector
+	if entity.NotSelector != "" {
+		notSelector = parseSelector(field+".notSelector", entity.NotSelector)
+	}
+	namespaceSelector := parseSelector(field+".namespaceSelector", entity.NamespaceSelector)
+
+	types := make([]string, 0, 3)
+	if entity.NamespaceSelector != "" {
+		types = append(types, "namespaceSelector")
+	}
+	if hasSelector {
+		types = append(types, "selector")
+	}
+	if len(entity.Nets) != 0 || len(entity.NotNets) != 0 {
+		types = append(types, "nets")
+	}
+	peerType := strings.Join(types, "+")
+	if peerType == "" {
+		peerType = "all"
+	}
+
+	return func(ep endpoint) (bool, string) {
+		if len(entity.Nets) != 0 && !containsIP(nets, ep.ips) {
+			return false, ""
+		}
+		if containsIP(notNets, ep.ips) {
+			return false, ""
+		}
+
+		if entity.NamespaceSelector != "" {
+			if !namespaceSelector(calicoNamespaceLabels(ep.namespace)) {
+				return false, ""
+			}
+		} else if hasSelector && !policy.Global && ep.pod.Namespace != policy.Namespace {
+			// namespaceSelectorのないselectorはpolicyと同じnamespaceのPodのみを対象とする
+			return false, ""
+		}
+
+		podLabels := calicoPodLabels(ep.pod)
+		if !selector(podLabels) {
+			return false, ""
+		}
+		if notSelector != nil && notSelector(podLabels) {
+			return false, ""
+		}
+		return true, peerType
+	}
+}
+
+// ルールが対象とする通信先のポートを求める．protocolの指定がない場合は全プロトコル．
+// 送信元ポートは評価しない
+func compileCalicoPorts(field string, rule CalicoRule, addWarning func(code string, field string, err error)) func(dest v1.Pod) PortSet {
+	protocol := calicoProtocol(rule.Protocol)
+	notProtocol := calicoProtocol(rule.NotProtocol)
+
+	type calicoPort struct {
+		port Port
+		// 名前付きポート
+		name string
+	}
+	parsePorts := func(field string, ports []intstr.IntOrString) []calicoPort {
+		res := make([]calicoPort, 0, len(ports))
+		for i, v := range ports {
+			if v.Type == intstr.Int {
+				res = append(res, calicoPort{port: Port{Protocol: protocol, Port: v.IntValue()}})
+				continue
+			}
+
+			start, end, isRange := strings.Cut(v.StrVal, ":")
+			startPort, err := strconv.Atoi(start)
+			if err != nil {
+				if isRange {
+					addWarning(WarningCodeInvalidPort, fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("invalid port range %q", v.StrVal))
+					continue
+				}
+				res = append(res, calicoPort{port: Port{Protocol: protocol}, name: v.StrVal})
+				continue
+			}
+			endPort := startPort
+			if isRange {
+				if endPort, err = strconv.Atoi(end); err != nil || endPort < startPort {
+					addWarning(WarningCodeInvalidPort, fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("invalid port range %q", v.StrVal))
+					continue
+				}
+			}
+			res = append(res, calicoPort{port: Port{Protocol: protocol, Port: startPort, EndPort: endPort}})
+		}
+		return res
+	}
+	ports := parsePorts(field+".destination.ports", rule.Destination.Ports)
+	notPorts := parsePorts(field+".destination.notPorts", rule.Destination.NotPorts)
+
+	toPortSet := func(ports []calicoPort, dest v1.Pod) PortSet {
+		res := make([]Port, 0, len(ports))
+		for _, p := range ports {
+			if p.name == "" {
+				res = append(res, p.port)
+				continue
+			}
+			// 名前付きポートは通信先のコンテナポートで解決する
+			for _, protocol := range expandProtocol(p.port.Protocol) {
+				k8sProtocol := v1.Protocol(protocol)
+				if portNumber, ok := resolveNamedPort(p.name, &k8sProtocol, dest); ok {
+					res = append(res, Port{Protocol: protocol, Port: portNumber, Name: p.name})
+				}
+			}
+		}
+		if len(res) == 0 {
+			return EmptyPortSet()
+		}
+		return NewPortSet(res)
+	}
+
+	return func(dest v1.Pod) PortSet {
+		if protocol == "" {
+			// ICMP等，ポートを持たないプロトコルは扱わない
+			return EmptyPortSet()
+		}
+		res := NewPortSet([]Port{{Protocol: protocol}})
+		if len(ports) != 0 {
+			res = toPortSet(ports, dest)
+		}
+		if len(notPorts) != 0 {
+			res = res.Subtract(toPortSet(notPorts, dest))
+		}
+		if rule.NotProtocol != nil && notProtocol != "" {
+			res = res.Subtract(NewPortSet([]Port{{Protocol: notProtocol}}))
+		}
+		return res
+	}
+}
+
+// Calicoのprotocol指定をPortSetのプロトコルに直す．指定なしはany，ポートを持たないプロトコルは空文字列
+func calicoProtocol(protocol *intstr.IntOrString) string {
+	if protocol == nil {
+		return "any"
+	}
+
+	if protocol.Type == intstr.Int {
+		switch protocol.IntValue() {
+		case 6:
+			return "TCP"
+		case 17:
+			return "UDP"
+		case 132:
+			return "SCTP"
+		default:
+			return ""
+		}
+	}
+
+	switch strings.ToUpper(protocol.StrVal) {
+	case "TCP", "UDP", "SCTP":
+		return strings.ToUpper(protocol.StrVal)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,315 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// calicoSelector はCalicoのselector構文を解析したもの
+type calicoSelector func(labelMap map[string]string) bool
+
+// Calicoのselector構文を解析する．空文字列は全てにマッチする．
+// 対応する構文: all(), global(), has(k), k == 'v', k != 'v', k in {'a','b'}, k not in {...},
+// k contains 'v', k starts with 'v', k ends with 'v', !, &&, ||, ()
+func parseCalicoSelector(s string) (calicoSelector, error) {
+	tokens, err := tokenizeCalicoSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return func(map[string]string) bool { return true }, nil
+	}
+
+	p := &calicoSelectorParser{tokens: tokens}
+	selector, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q in selector %q", p.peek().value, s)
+	}
+	return selector, nil
+}
+
+type calicoTokenKind int
+
+const (
+	calicoTokenIdent calicoTokenKind = iota
+	calicoTokenString
+	calicoTokenSymbol
+)
+
+type calicoToken struct {
+	kind  calicoTokenKind
+	value string
+}
+
+func isCalicoIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_./-", c) >= 0
+}
+
+func tokenizeCalicoSelector(s string) ([]calicoToken, error) {
+	tokens := make([]calicoToken, 0)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in selector %q", s)
+			}
+			tokens = append(tokens, calicoToken{kind: calicoTokenString, value: s[i+1 : i+1+end]})
+			i += end + 2
+		case strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, calicoToken{kind: calicoTokenSymbol, value: s[i : i+2]})
+			i += 2
+		case strings.IndexByte("!(){},", c) >= 0:
+			tokens = append(tokens, calicoToken{kind: calicoTokenSymbol, value: string(c)})
+			i++
+		case isCalicoIdentChar(c):
+			start := i
+			for i < len(s) && isCalicoIdentChar(s[i]) {
+				i++
+			}
+			tokens = append(tokens, calicoToken{kind: calicoTokenIdent, value: s[start:i]})
+		default:
+			return nil, fmt.Errorf("unexpected character %q in selector %q", c, s)
+		}
+	}
+	return tokens, nil
+}
+
+type calicoSelectorParser struct {
+	tokens []calicoToken
+	pos    int
+}
+
+func (p *calicoSelectorParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *calicoSelectorParser) peek() calicoToken {
+	if p.done() {
+		return calicoToken{kind: calicoTokenSymbol, value: "EOF"}
+	}
+	return p.tokens[p.pos]
+}
+
+// 次のトークンがkind, valueに一致すれば読み進める
+func (p *calicoSelectorParser) accept(kind calicoTokenKind, value string) bool {
+	t := p.peek()
+	if !p.done() && t.kind == kind && t.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *calicoSelectorParser) expect(kind calicoTokenKind, value string) error {
+	if !p.accept(kind, value) {
+		return fmt.Errorf("expected %q but got %q", value, p.peek().value)
+	}
+	return nil
+}
+
+func (p *calicoSelectorParser) expectKind(kind calicoTokenKind) (string, error) {
+	t := p.peek()
+	if p.done() || t.kind != kind {
+		return "", fmt.Errorf("unexpected %q", t.value)
+	}
+	p.pos++
+	return t.value, nil
+}
+
+func (p *calicoSelectorParser) parseOr() (calicoSelector, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(calicoTokenSymbol, "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(labelMap map[string]string) bool { return l(labelMap) || right(labelMap) }
+	}
+	return left, nil
+}
+
+func (p *calicoSelectorParser) parseAnd() (calicoSelector, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(calicoTokenSymbol, "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(labelMap map[string]string) bool { return l(labelMap) && right(labelMap) }
+	}
+	return left, nil
+}
+
+func (p *calicoSelectorParser) parseUnary() (calicoSelector, error) {
+	if p.accept(calicoTokenSymbol, "!") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(labelMap map[string]string) bool { return !inner(labelMap) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *calicoSelectorParser) parsePrimary() (calicoSelector, error) {
+	if p.accept(calicoTokenSymbol, "(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(calicoTokenSymbol, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	ident, err := p.expectKind(calicoTokenIdent)
+	if err != nil {
+		return nil, err
+	}
+
+	// 関数形式
+	if p.accept(calicoTokenSymbol, "(") {
+		switch ident {
+		case "all":
+			if err := p.expect(calicoTokenSymbol, ")"); err != nil {
+				return nil, err
+			}
+			return func(map[string]string) bool { return true }, nil
+		case "global":
+			// namespaceに属さないエンドポイントを表すのでPodにはマッチしない
+			if err := p.expect(calicoTokenSymbol, ")"); err != nil {
+				return nil, err
+			}
+			return func(map[string]string) bool { return false }, nil
+		case "has":
+			key, err := p.expectKind(calicoTokenIdent)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(calicoTokenSymbol, ")"); err != nil {
+				return nil, err
+			}
+			return func(labelMap map[string]string) bool {
+				_, ok := labelMap[key]
+				return ok
+			}, nil
+		default:
+			return nil, fmt.Errorf("unknown function %q", ident)
+		}
+	}
+
+	return p.parseComparison(ident)
+}
+
+// key op valueの形式
+func (p *calicoSelectorParser) parseComparison(key string) (calicoSelector, error) {
+	switch {
+	case p.accept(calicoTokenSymbol, "=="):
+		value, err := p.expectKind(calicoTokenString)
+		if err != nil {
+			return nil, err
+		}
+		return func(labelMap map[string]string) bool {
+			v, ok := labelMap[key]
+			return ok && v == value
+		}, nil
+	case p.accept(calicoTokenSymbol, "!="):
+		value, err := p.expectKind(calicoTokenString)
+		if err != nil {
+			return nil, err
+		}
+		return func(labelMap map[string]string) bool {
+			v, ok := labelMap[key]
+			return !ok || v != value
+		}, nil
+	case p.accept(calicoTokenIdent, "in"):
+		values, err := p.parseSet()
+		if err != nil {
+			return nil, err
+		}
+		return func(labelMap map[string]string) bool {
+			v, ok := labelMap[key]
+			_, in := values[v]
+			return ok && in
+		}, nil
+	case p.accept(calicoTokenIdent, "not"):
+		if err := p.expect(calicoTokenIdent, "in"); err != nil {
+			return nil, err
+		}
+		values, err := p.parseSet()
+		if err != nil {
+			return nil, err
+		}
+		return func(labelMap map[string]string) bool {
+			v, ok := labelMap[key]
+			_, in := values[v]
+			return !ok || !in
+		}, nil
+	case p.accept(calicoTokenIdent, "contains"):
+		return p.parseStringMatch(key, strings.Contains)
+	case p.accept(calicoTokenIdent, "starts"):
+		if err := p.expect(calicoTokenIdent, "with"); err != nil {
+			return nil, err
+		}
+		return p.parseStringMatch(key, strings.HasPrefix)
+	case p.accept(calicoTokenIdent, "ends"):
+		if err := p.expect(calicoTokenIdent, "with"); err != nil {
+			return nil, err
+		}
+		return p.parseStringMatch(key, strings.HasSuffix)
+	default:
+		return nil, fmt.Errorf("expected operator after %q but got %q", key, p.peek().value)
+	}
+}
+
+func (p *calicoSelectorParser) parseStringMatch(key string, match func(s, substr string) bool) (calicoSelector, error) {
+	value, err := p.expectKind(calicoTokenString)
+	if err != nil {
+		return nil, err
+	}
+	return func(labelMap map[string]string) bool {
+		v, ok := labelMap[key]
+		return ok && match(v, value)
+	}, nil
+}
+
+// {'a', 'b'}の形式
+func (p *calicoSelectorParser) parseSet() (map[string]struct{}, error) {
+	if err := p.expect(calicoTokenSymbol, "{"); err != nil {
+		return nil, err
+	}
+	values := make(map[string]struct{})
+	if p.accept(calicoTokenSymbol, "}") {
+		return values, nil
+	}
+	for {
+		value, err := p.expectKind(calicoTokenString)
+		if err != nil {
+			return nil, err
+		}
+		values[value] = struct{}{}
+		if p.accept(calicoTokenSymbol, "}") {
+			return values, nil
+		}
+		if err := p.expect(calicoTokenSymbol, ","); err != nil {
+			return nil, err
+		}
+	}
+}
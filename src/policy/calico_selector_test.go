@@ -0,0 +1,77 @@
+package policy
+
+import "testing"
+
+func TestParseCalicoSelector(t *testing.T) {
+	labels := map[string]string{
+		"app":  "web",
+		"tier": "frontend",
+		"env":  "prod-east",
+	}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"all()", true},
+		// global()はnamespaceに属さないエンドポイントでPodにはマッチしない
+		{"global()", false},
+		{"has(app)", true},
+		{"has(owner)", false},
+		{"!has(owner)", true},
+		{"app == 'web'", true},
+		{`app == "web"`, true},
+		{"app == 'db'", false},
+		{"app != 'db'", true},
+		{"owner != 'x'", true},
+		{"app in {'web', 'db'}", true},
+		{"app in {'db'}", false},
+		{"app not in {'db'}", true},
+		{"owner not in {'x'}", true},
+		{"env contains 'east'", true},
+		{"env starts with 'prod'", true},
+		{"env ends with 'west'", false},
+		{"owner contains 'a'", false},
+		{"app == 'web' && tier == 'frontend'", true},
+		{"app == 'web' && tier == 'backend'", false},
+		{"app == 'db' || tier == 'frontend'", true},
+		// &&は||より優先する
+		{"app == 'db' && tier == 'x' || env == 'prod-east'", true},
+		{"app == 'db' && (tier == 'x' || env == 'prod-east')", false},
+		{"!(app == 'db' || has(owner))", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := parseCalicoSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("parseCalicoSelector(%q) error = %v", tt.selector, err)
+			}
+			if got := selector(labels); got != tt.want {
+				t.Errorf("parseCalicoSelector(%q) matches %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCalicoSelectorError(t *testing.T) {
+	tests := []string{
+		"app ==",
+		"app == 'web",
+		"has(app",
+		"app in {'a'",
+		"app == 'web' &&",
+		"(app == 'web'",
+		"app == 'web')",
+		"app ~ 'web'",
+	}
+
+	for _, s := range tests {
+		t.Run(s, func(t *testing.T) {
+			if _, err := parseCalicoSelector(s); err == nil {
+				t.Errorf("parseCalicoSelector(%q) error = nil", s)
+			}
+		})
+	}
+}
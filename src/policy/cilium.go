@@ -0,0 +1,424 @@
+package policy
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Ciliumの拒否ルールは順序に関係なく許可ルールより優先されるので，default層の先頭で評価する
+const ciliumDenyOrder = -math.MaxFloat64
+
+const ciliumNamespaceLabel = "io.kubernetes.pod.namespace"
+
+// CiliumPolicy はcilium.ioのCiliumNetworkPolicy, CiliumClusterwideNetworkPolicy
+type CiliumPolicy struct {
+	Name      string
+	Namespace string
+	// CiliumClusterwideNetworkPolicyならtrue
+	Clusterwide bool
+	// spec, specsをまとめたもの
+	Specs []CiliumRule
+}
+
+type CiliumRule struct {
+	EndpointSelector  *metav1.LabelSelector    `json:"endpointSelector,omitempty"`
+	Ingress           []CiliumIngressRule      `json:"ingress,omitempty"`
+	IngressDeny       []CiliumIngressRule      `json:"ingressDeny,omitempty"`
+	Egress            []CiliumEgressRule       `json:"egress,omitempty"`
+	EgressDeny        []CiliumEgressRule       `json:"egressDeny,omitempty"`
+	EnableDefaultDeny *CiliumDefaultDenyConfig `json:"enableDefaultDeny,omitempty"`
+}
+
+type CiliumDefaultDenyConfig struct {
+	Ingress *bool `json:"ingress,omitempty"`
+	Egress  *bool `json:"egress,omitempty"`
+}
+
+type CiliumIngressRule struct {
+	FromEndpoints []metav1.LabelSelector `json:"fromEndpoints,omitempty"`
+	FromEntities  []string               `json:"fromEntities,omitempty"`
+	FromCIDR      []string               `json:"fromCIDR,omitempty"`
+	FromCIDRSet   []CiliumCIDRRule       `json:"fromCIDRSet,omitempty"`
+	ToPorts       []CiliumPortRule       `json:"toPorts,omitempty"`
+}
+
+type CiliumEgressRule struct {
+	ToEndpoints []metav1.LabelSelector `json:"toEndpoints,omitempty"`
+	ToEntities  []string               `json:"toEntities,omitempty"`
+	ToCIDR      []string               `json:"toCIDR,omitempty"`
+	ToCIDRSet   []CiliumCIDRRule       `json:"toCIDRSet,omitempty"`
+	ToPorts     []CiliumPortRule       `json:"toPorts,omitempty"`
+}
+
+type CiliumCIDRRule struct {
+	Cidr   string   `json:"cidr"`
+	Except []string `json:"except,omitempty"`
+}
+
+type CiliumPortRule struct {
+	Ports []CiliumPortProtocol `json:"ports,omitempty"`
+}
+
+type CiliumPortProtocol struct {
+	Port     string `json:"port,omitempty"`
+	EndPort  int32  `json:"endPort,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// ingress, egressのルールを方向に関係なく扱うための形
+type ciliumPeerRule struct {
+	// フィールド名の接頭辞(from, to)
+	prefix    string
+	endpoints []metav1.LabelSelector
+	entities  []string
+	cidrs     []string
+	cidrSets  []CiliumCIDRRule
+	toPorts   []CiliumPortRule
+}
+
+func (r CiliumIngressRule) peerRule() ciliumPeerRule {
+	return ciliumPeerRule{prefix: "from", endpoints: r.FromEndpoints, entities: r.FromEntities, cidrs: r.FromCIDR, cidrSets: r.FromCIDRSet, toPorts: r.ToPorts}
+}
+
+func (r CiliumEgressRule) peerRule() ciliumPeerRule {
+	return ciliumPeerRule{prefix: "to", endpoints: r.ToEndpoints, entities: r.ToEntities, cidrs: r.ToCIDR, cidrSets: r.ToCIDRSet, toPorts: r.ToPorts}
+}
+
+func (p CiliumPolicy) kind() string {
+	if p.Clusterwide {
+		return "CiliumClusterwideNetworkPolicy"
+	}
+	return "CiliumNetworkPolicy"
+}
+
+// NewCiliumPolicy はdynamic clientで取得したCiliumNetworkPolicy, CiliumClusterwideNetworkPolicyを変換する
+func NewCiliumPolicy(obj unstructured.Unstructured) (CiliumPolicy, error) {
+	res := CiliumPolicy{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		// CiliumClusterwideNetworkPolicyはnamespaceに属さない
+		Clusterwide: obj.GetNamespace() == "",
+	}
+
+	// specは単一のルール，specsはルールの一覧
+	spec := struct {
+		Spec  *CiliumRule  `json:"spec,omitempty"`
+		Specs []CiliumRule `json:"specs,omitempty"`
+	}{}
+	if err := convertUnstructuredObject(obj, &spec); err != nil {
+		return CiliumPolicy{}, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	if spec.Spec != nil {
+		res.Specs = append(res.Specs, *spec.Spec)
+	}
+	res.Specs = append(res.Specs, spec.Specs...)
+	return res, nil
+}
+
+// Ciliumがselectorの評価に使うPodのラベル．Pod自身のラベルにnamespace, namespaceのラベル等が加わる
+func ciliumPodLabels(ep endpoint) map[string]string {
+	res := make(map[string]string, len(ep.pod.Labels)+len(ep.namespace.Labels)+2)
+	for k, v := range ep.pod.Labels {
+		res[k] = v
+	}
+	for k, v := range ep.namespace.Labels {
+		res["io.cilium.k8s.namespace.labels."+k] = v
+	}
+	res[ciliumNamespaceLabel] = ep.pod.Namespace
+	serviceAccount := ep.pod.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	res["io.cilium.k8s.policy.serviceaccount"] = serviceAccount
+	return res
+}
+
+// Ciliumのselectorのキーに付くk8s:, any:の接頭辞を外す
+func normalizeCiliumSelector(selector metav1.LabelSelector) metav1.LabelSelector {
+	trim := func(key string) string {
+		for _, prefix := range []string{"k8s:", "any:"} {
+			if strings.HasPrefix(key, prefix) {
+				return strings.TrimPrefix(key, prefix)
+			}
+		}
+		return key
+	}
+
+	res := metav1.LabelSelector{}
+	if selector.MatchLabels != nil {
+		res.MatchLabels = make(map[string]string, len(selector.MatchLabels))
+		for k, v := range selector.MatchLabels {
+			res.MatchLabels[trim(k)] = v
+		}
+	}
+	for _, v := range selector.MatchExpressions {
+		v.Key = trim(v.Key)
+		res.MatchExpressions = append(res.MatchExpressions, v)
+	}
+	return res
+}
+
+// selectorがnamespaceを指定しているか
+func hasCiliumNamespaceSelector(selector metav1.LabelSelector) bool {
+	if _, ok := selector.MatchLabels[ciliumNamespaceLabel]; ok {
+		return true
+	}
+	for _, v := range selector.MatchExpressions {
+		if v.Key == ciliumNamespaceLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// Ciliumのpolicyを評価用に変換する．specごとに許可ルールと拒否ルールを別のpolicyとして返す
+func compileCiliumPolicy(policy CiliumPolicy) ([]*compiledPolicy, []Warning) {
+	warnings := make([]Warning, 0)
+	addWarning := func(code string, field string, err error) {
+		warnings = append(warnings, Warning{
+			Kind:       policy.kind(),
+			PolicyName: policy.Name,
+			Namespace:  policy.Namespace,
+			Code:       code,
+			Field:      field,
+			Message:    err.Error(),
+		})
+	}
+	// CiliumNetworkPolicyのselectorはnamespaceの指定がなければpolicyと同じnamespaceのPodのみを選択する
+	compileSelector := func(field string, selector metav1.LabelSelector) func(ep endpoint) bool {
+		normalized := normalizeCiliumSelector(selector)
+		s, err := metav1.LabelSelectorAsSelector(&normalized)
+		if err != nil {
+			addWarning(WarningCodeInvalidSelector, field, err)
+			return nil
+		}
+		scoped := !policy.Clusterwide && !hasCiliumNamespaceSelector(normalized)
+		return func(ep endpoint) bool {
+			if scoped && ep.pod.Namespace != policy.Namespace {
+				return false
+			}
+			return s.Matches(labels.Set(ciliumPodLabels(ep)))
+		}
+	}
+
+	source := PolicySource{
+		Engine:    EngineCilium,
+		Tier:      defaultTierName,
+		Name:      policy.Name,
+		Namespace: policy.Namespace,
+	}
+	res := make([]*compiledPolicy, 0, 2*len(policy.Specs))
+	for i, spec := range policy.Specs {
+		field := "spec"
+		if len(policy.Specs) > 1 {
+			field = fmt.Sprintf("specs[%d]", i)
+		}
+		if spec.EndpointSelector == nil {
+			// nodeSelectorによるホストのpolicyはPod間の通信に関係しない
+			continue
+		}
+		selects := compileSelector(field+".endpointSelector", *spec.EndpointSelector)
+
+		compileRules := func(field string, rules []ciliumPeerRule, action Action) []compiledRule {
+			res := make([]compiledRule, 0, len(rules))
+			for j, rule := range rules {
+				res = append(res, compileCiliumRule(fmt.Sprintf("%s[%d]", field, j), j, rule, action, compileSelector, addWarning))
+			}
+			return res
+		}
+		ingress := make([]ciliumPeerRule, 0, len(spec.Ingress))
+		for _, v := range spec.Ingress {
+			ingress = append(ingress, v.peerRule())
+		}
+		ingressDeny := make([]ciliumPeerRule, 0, len(spec.IngressDeny))
+		for _, v := range spec.IngressDeny {
+			ingressDeny = append(ingressDeny, v.peerRule())
+		}
+		egress := make([]ciliumPeerRule, 0, len(spec.Egress))
+		for _, v := range spec.Egress {
+			egress = append(egress, v.peerRule())
+		}
+		egressDeny := make([]ciliumPeerRule, 0, len(spec.EgressDeny))
+		for _, v := range spec.EgressDeny {
+			egressDeny = append(egressDeny, v.peerRule())
+		}
+
+		// 許可，拒否のどちらかのルールがあればその方向について隔離される
+		hasIngress := len(ingress) != 0 || len(ingressDeny) != 0
+		hasEgress := len(egress) != 0 || len(egressDeny) != 0
+		defaultAllowIngress, defaultAllowEgress := false, false
+		if spec.EnableDefaultDeny != nil {
+			defaultAllowIngress = spec.EnableDefaultDeny.Ingress != nil && !*spec.EnableDefaultDeny.Ingress
+			defaultAllowEgress = spec.EnableDefaultDeny.Egress != nil && !*spec.EnableDefaultDeny.Egress
+		}
+
+		allow := &compiledPolicy{
+			source:              source,
+			order:               networkPolicyOrder,
+			selects:             selects,
+			hasIngress:          hasIngress,
+			hasEgress:           hasEgress,
+			defaultAllowIngress: defaultAllowIngress,
+			defaultAllowEgress:  defaultAllowEgress,
+			ingress:             compileRules(field+".ingress", ingress, ActionAllow),
+			egress:              compileRules(field+".egress", egress, ActionAllow),
+		}
+		deny := &compiledPolicy{
+			source:              source,
+			order:               ciliumDenyOrder,
+			selects:             selects,
+			hasIngress:          hasIngress,
+			hasEgress:           hasEgress,
+			defaultAllowIngress: defaultAllowIngress,
+			defaultAllowEgress:  defaultAllowEgress,
+			ingress:             compileRules(field+".ingressDeny", ingressDeny, ActionDeny),
+			egress:              compileRules(field+".egressDeny", egressDeny, ActionDeny),
+		}
+		res = append(res, allow, deny)
+	}
+
+	if len(warnings) != 0 {
+		return nil, warnings
+	}
+	return res, nil
+}
+
+// ルール一つを変換する．fromEndpoints, fromEntities, fromCIDR等はOR条件で，L3の指定がなくtoPortsのみのルールは全ての相手にマッチする
+func compileCiliumRule(
+	field string,
+	index int,
+	rule ciliumPeerRule,
+	action Action,
+	compileSelector func(field string, selector metav1.LabelSelector) func(ep endpoint) bool,
+	addWarning func(code string, field string, err error),
+) compiledRule {
+	endpointSelectors := make([]func(ep endpoint) bool, 0, len(rule.endpoints))
+	for i, v := range rule.endpoints {
+		if s := compileSelector(fmt.Sprintf("%s.%sEndpoints[%d]", field, rule.prefix, i), v); s != nil {
+			endpointSelectors = append(endpointSelectors, s)
+		}
+	}
+
+	// CIDRのルールはクラスター外の通信のみが対象でPodにはマッチしない．記述の誤りは検出する
+	for i, v := range rule.cidrs {
+		if _, _, err := net.ParseCIDR(v); err != nil {
+			addWarning(WarningCodeInvalidCIDR, fmt.Sprintf("%s.%sCIDR[%d]", field, rule.prefix, i), err)
+		}
+	}
+	for i, v := range rule.cidrSets {
+		if _, _, err := net.ParseCIDR(v.Cidr); err != nil {
+			addWarning(WarningCodeInvalidCIDR, fmt.Sprintf("%s.%sCIDRSet[%d].cidr", field, rule.prefix, i), err)
+		}
+		for j, except := range v.Except {
+			if _, _, err := net.ParseCIDR(except); err != nil {
+				addWarning(WarningCodeInvalidCIDR, fmt.Sprintf("%s.%sCIDRSet[%d].except[%d]", field, rule.prefix, i, j), err)
+			}
+		}
+	}
+
+	ports := make([]Port, 0)
+	namedPorts := make([]Port, 0)
+	for i, portRule := range rule.toPorts {
+		for j, p := range portRule.Ports {
+			portField := fmt.Sprintf("%s.toPorts[%d].ports[%d]", field, i, j)
+			protocol, ok := ciliumProtocol(p.Protocol)
+			if !ok {
+				addWarning(WarningCodeInvalidPort, portField+".protocol", fmt.Errorf("unsupported protocol %q", p.Protocol))
+				continue
+			}
+			if p.Port == "" {
+				ports = append(ports, Port{Protocol: protocol})
+				continue
+			}
+			portNumber, err := strconv.Atoi(p.Port)
+			if err != nil {
+				namedPorts = append(namedPorts, Port{Protocol: protocol, Name: p.Port})
+				continue
+			}
+			if portNumber < 0 || portNumber > maxPort || (p.EndPort != 0 && int(p.EndPort) < portNumber) {
+				addWarning(WarningCodeInvalidPort, portField, fmt.Errorf("invalid port %q", p.Port))
+				continue
+			}
+			ports = append(ports, Port{Protocol: protocol, Port: portNumber, EndPort: int(p.EndPort)})
+		}
+	}
+	hasL3 := len(rule.endpoints) != 0 || len(rule.entities) != 0 || len(rule.cidrs) != 0 || len(rule.cidrSets) != 0
+	hasL4 := len(rule.toPorts) != 0
+
+	// L3の指定がないルールとworld, allのentityはクラスター外の全てにマッチする
+	externalRanges := cidrsToRanges(rule.cidrs, nil)
+	for _, v := range rule.cidrSets {
+		externalRanges = append(externalRanges, cidrsToRanges([]string{v.Cidr}, v.Except)...)
+	}
+	for _, entity := range rule.entities {
+		if entity == "world" || entity == "all" {
+			externalRanges = allIPRanges
+		}
+	}
+	if !hasL3 && hasL4 {
+		externalRanges = allIPRanges
+	}
+
+	return compiledRule{
+		externalRanges: externalRanges,
+		index:          index,
+		action:         action,
+		match: func(self endpoint, peer endpoint) (bool, int, string) {
+			if !hasL3 {
+				// 空のルールは何にもマッチしない
+				return hasL4, -1, "all"
+			}
+			for _, s := range endpointSelectors {
+				if s(peer) {
+					return true, -1, "endpoints"
+				}
+			}
+			for _, entity := range rule.entities {
+				// Podはcluster, allにのみ含まれる
+				if entity == "cluster" || entity == "all" {
+					return true, -1, "entities"
+				}
+			}
+			return false, -1, ""
+		},
+		ports: func(dest v1.Pod) PortSet {
+			if !hasL4 {
+				return AllPortSet()
+			}
+			res := make([]Port, 0, len(ports)+len(namedPorts))
+			res = append(res, ports...)
+			// 名前付きポートは通信先のコンテナポートで解決する
+			for _, p := range namedPorts {
+				for _, protocol := range expandProtocol(p.Protocol) {
+					k8sProtocol := v1.Protocol(protocol)
+					if portNumber, ok := resolveNamedPort(p.Name, &k8sProtocol, dest); ok {
+						res = append(res, Port{Protocol: protocol, Port: portNumber, Name: p.Name})
+					}
+				}
+			}
+			if len(res) == 0 {
+				return EmptyPortSet()
+			}
+			return NewPortSet(res)
+		},
+	}
+}
+
+// Ciliumのprotocol指定をPortSetのプロトコルに直す．省略とANYはany
+func ciliumProtocol(protocol string) (string, bool) {
+	switch strings.ToUpper(protocol) {
+	case "", "ANY":
+		return "any", true
+	case "TCP", "UDP", "SCTP":
+		return strings.ToUpper(protocol), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,406 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"sync"
+)
+
+// PolicySet はEngineが評価するpolicyの一覧
+type PolicySet struct {
+	NetworkPolicies []netv1.NetworkPolicy
+	// CalicoのNetworkPolicy, GlobalNetworkPolicyとTier
+	CalicoPolicies []CalicoPolicy
+	CalicoTiers    []CalicoTier
+	// CiliumNetworkPolicy, CiliumClusterwideNetworkPolicy
+	CiliumPolicies []CiliumPolicy
+	// Network Policyより前に評価するAdminNetworkPolicyと，後に評価するBaselineAdminNetworkPolicy
+	AdminNetworkPolicies         []AdminNetworkPolicy
+	BaselineAdminNetworkPolicies []AdminNetworkPolicy
+	// 取得したが変換できなかったオブジェクトの警告
+	Warnings []Warning
+}
+
+// Engine はPod, Namespace, NetworkPolicyの一覧からPod間の通信可否を評価する
+type Engine struct {
+	pods         []v1.Pod
+	namespaceMap map[string]v1.Namespace
+	policies     []netv1.NetworkPolicy
+	warnings     []Warning
+	// 評価順に並べた層．警告のあるpolicyは含まない
+	tiers []*compiledTier
+
+	// Podごとの適用された層のメモ
+	mu               sync.Mutex
+	appliedTierCache map[string][]appliedTier
+}
+
+func NewEngine(pods []v1.Pod, namespaces []v1.Namespace, policies []netv1.NetworkPolicy) *Engine {
+	return NewEngineWithPolicySet(pods, namespaces, PolicySet{NetworkPolicies: policies})
+}
+
+func NewEngineWithPolicySet(pods []v1.Pod, namespaces []v1.Namespace, policySet PolicySet) *Engine {
+	// 評価できない記述を含むpolicyは警告を残して除外する
+	warnings := append(make([]Warning, 0), policySet.Warnings...)
+	tierMap := make(map[string]*compiledTier)
+	getTier := func(name string) *compiledTier {
+		if t, ok := tierMap[name]; ok {
+			return t
+		}
+		t := &compiledTier{name: name, order: unorderedPolicyOrder, defaultDeny: true}
+		tierMap[name] = t
+		return t
+	}
+	getTier(defaultTierName).order = defaultTierOrder
+	for _, tier := range policySet.CalicoTiers {
+		t := getTier(tier.Name)
+		if tier.Order != nil {
+			t.order = *tier.Order
+		}
+		// defaultActionがPassの層はマッチしなかった通信を次の層で評価する
+		t.defaultDeny = tier.DefaultAction != string(ActionPass)
+	}
+
+	for _, policy := range policySet.NetworkPolicies {
+		policyWarnings := validatePolicy(policy)
+		if len(policyWarnings) != 0 {
+			warnings = append(warnings, policyWarnings...)
+			continue
+		}
+		warnings = append(warnings, validatePolicyPorts(policy)...)
+		t := getTier(defaultTierName)
+		t.policies = append(t.policies, compileNetworkPolicy(policy))
+	}
+
+	for _, policy := range policySet.CalicoPolicies {
+		compiled, policyWarnings := compileCalicoPolicy(policy)
+		if len(policyWarnings) != 0 {
+			warnings = append(warnings, policyWarnings...)
+			continue
+		}
+		t := getTier(compiled.source.Tier)
+		t.policies = append(t.policies, compiled)
+	}
+
+	for _, policy := range policySet.CiliumPolicies {
+		compiled, policyWarnings := compileCiliumPolicy(policy)
+		if len(policyWarnings) != 0 {
+			warnings = append(warnings, policyWarnings...)
+			continue
+		}
+		t := getTier(defaultTierName)
+		t.policies = append(t.policies, compiled...)
+	}
+
+	// AdminNetworkPolicy, BaselineAdminNetworkPolicyの層はルールにマッチしなかった通信を次の層で評価する
+	adminTier := &compiledTier{name: adminTierName, order: adminTierOrder}
+	for _, policy := range policySet.AdminNetworkPolicies {
+		compiled, policyWarnings := compileAdminNetworkPolicy(policy, false)
+		if len(policyWarnings) != 0 {
+			warnings = append(warnings, policyWarnings...)
+			continue
+		}
+		adminTier.policies = append(adminTier.policies, compiled)
+	}
+	baselineTier := &compiledTier{name: baselineTierName, order: unorderedPolicyOrder}
+	for _, policy := range policySet.BaselineAdminNetworkPolicies {
+		compiled, policyWarnings := compileAdminNetworkPolicy(policy, true)
+		if len(policyWarnings) != 0 {
+			warnings = append(warnings, policyWarnings...)
+			continue
+		}
+		baselineTier.policies = append(baselineTier.policies, compiled)
+	}
+
+	tiers := make([]*compiledTier, 0, len(tierMap)+2)
+	for _, t := range tierMap {
+		sortPolicies(t.policies)
+		tiers = append(tiers, t)
+	}
+	sortTiers(tiers)
+	sortPolicies(adminTier.policies)
+	tiers = append([]*compiledTier{adminTier}, tiers...)
+	tiers = append(tiers, baselineTier)
+
+	return &Engine{
+		pods:             pods,
+		namespaceMap:     getNamespaceMap(namespaces),
+		policies:         policySet.NetworkPolicies,
+		warnings:         warnings,
+		tiers:            tiers,
+		appliedTierCache: make(map[string][]appliedTier),
+	}
+}
+
+// Podにその方向で適用される層の一覧を取得する．同じPodについては一度だけ計算する
+func (e *Engine) getAppliedTiers(pod v1.Pod, direction Direction) []appliedTier {
+	key := string(direction) + "/" + pod.Namespace + "/" + pod.Name
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if v, ok := e.appliedTierCache[key]; ok {
+		return v
+	}
+
+	self := e.getEndpoint(pod)
+	res := make([]appliedTier, 0)
+	for _, t := range e.tiers {
+		applied := appliedTier{tier: t, policies: make([]*compiledPolicy, 0)}
+		for _, policy := range t.policies {
+			if policy.appliesTo(direction) && policy.selects(self) {
+				applied.policies = append(applied.policies, policy)
+				applied.defaultDeny = applied.defaultDeny || (t.defaultDeny && policy.isolates(direction))
+			}
+		}
+		if len(applied.policies) != 0 {
+			res = append(res, applied)
+		}
+	}
+	e.appliedTierCache[key] = res
+	return res
+}
+
+func (e *Engine) getEndpoint(pod v1.Pod) endpoint {
+	return endpoint{
+		pod:       pod,
+		namespace: e.namespaceMap[pod.Namespace],
+		ips:       GetPodIPs(pod),
+	}
+}
+
+// Podに適用されたpolicyの一覧(ingress, egressの順で重複なし)
+func (e *Engine) getAppliedPolicies(pod v1.Pod) []PolicySource {
+	res := make([]PolicySource, 0)
+	seen := make(map[PolicySource]struct{})
+	for _, direction := range []Direction{DirectionIngress, DirectionEgress} {
+		for _, t := range e.getAppliedTiers(pod, direction) {
+			for _, policy := range t.policies {
+				if _, ok := seen[policy.source]; ok {
+					continue
+				}
+				seen[policy.source] = struct{}{}
+				res = append(res, policy.source)
+			}
+		}
+	}
+	return res
+}
+
+// IngressPolicies はPodにingressで適用されたpolicyの一覧を返す
+func (e *Engine) IngressPolicies(pod v1.Pod) []PolicySource {
+	res := make([]PolicySource, 0)
+	for _, t := range e.getAppliedTiers(pod, DirectionIngress) {
+		for _, policy := range t.policies {
+			if !containsPolicySource(res, policy.source) {
+				res = append(res, policy.source)
+			}
+		}
+	}
+	return res
+}
+
+// Warnings は評価できなかったNetwork Policyの記述の一覧を返す
+func (e *Engine) Warnings() []Warning {
+	return e.warnings
+}
+
+// IsIsolated はPodがingress, egressそれぞれについていずれかのpolicyによって隔離されているかを返す
+func (e *Engine) IsIsolated(pod v1.Pod) (bool, bool) {
+	return e.isIsolated(pod, DirectionIngress), e.isIsolated(pod, DirectionEgress)
+}
+
+func (e *Engine) isIsolated(pod v1.Pod, direction Direction) bool {
+	for _, t := range e.getAppliedTiers(pod, direction) {
+		if t.defaultDeny {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate はtargetPodと全Podとの間のingress, egressの通信可否を返す
+func (e *Engine) Evaluate(targetPod v1.Pod) (Result, error) {
+	// targetPodに適用されたpolicyの名前一覧をを返却用に作る
+	appliedPolicies := e.getAppliedPolicies(targetPod)
+	policyNames := make([]string, 0, len(appliedPolicies))
+	for _, v := range appliedPolicies {
+		policyNames = append(policyNames, v.Name)
+	}
+
+	peers := make([]PeerResult, len(e.pods))
+	for i, pod := range e.pods {
+		peers[i] = e.EvaluatePeer(targetPod, pod)
+	}
+
+	return Result{
+		Target:          targetPod,
+		PolicyNames:     policyNames,
+		AppliedPolicies: appliedPolicies,
+		Peers:           peers,
+		ExternalIngress: e.getExternalPeers(targetPod, DirectionIngress),
+		ExternalEgress:  e.getExternalPeers(targetPod, DirectionEgress),
+		Warnings:        e.warnings,
+	}, nil
+}
+
+// EvaluatePeer はtargetPodとpod一つとの間のingress, egressの通信可否を返す
+func (e *Engine) EvaluatePeer(targetPod v1.Pod, pod v1.Pod) PeerResult {
+	res := PeerResult{Pod: pod}
+	if isSamePod(pod, targetPod) {
+		// 自身は常にいかなるポートでも通信可
+		res.Ingress = Access{Allowed: true, Ports: AllPortSet().Ports(), Explanations: []Explanation{newSelfExplanation(DirectionIngress)}}
+		res.Egress = Access{Allowed: true, Ports: AllPortSet().Ports(), Explanations: []Explanation{newSelfExplanation(DirectionEgress)}}
+		return res
+	}
+
+	// PodからtargetPodへの通信
+	res.Ingress = e.getAccess(pod, targetPod, DirectionIngress)
+	// targetPodからPodへの通信
+	res.Egress = e.getAccess(targetPod, pod, DirectionEgress)
+	return res
+}
+
+// SelectedPods はいずれかのpolicyがingress, egressのどちらかで選択しているPodの一覧を返す．
+// policyの変更で通信可否が変わりうるPodを求めるのに使う
+func (e *Engine) SelectedPods() []v1.Pod {
+	res := make([]v1.Pod, 0)
+	for _, pod := range e.pods {
+		if len(e.getAppliedTiers(pod, DirectionIngress)) != 0 || len(e.getAppliedTiers(pod, DirectionEgress)) != 0 {
+			res = append(res, pod)
+		}
+	}
+	return res
+}
+
+// Check はfromPodからtoPodへの通信の可否を返す
+func (e *Engine) Check(fromPod v1.Pod, toPod v1.Pod) (Access, error) {
+	if isSamePod(fromPod, toPod) {
+		// 自身は常にいかなるポートでも通信可
+		return Access{Allowed: true, Ports: AllPortSet().Ports(), Explanations: []Explanation{newSelfExplanation(DirectionIngress)}}, nil
+	}
+
+	// toPodのingressをtargetとして評価する
+	return e.getAccess(fromPod, toPod, DirectionIngress), nil
+}
+
+// fromPodからtoPodへの通信の可否を求める．どちらかのPodが評価できない状態の場合，共通するアドレスファミリーがない場合は許可しない．
+// 両方のPodが複数のアドレスファミリーのIPを持つ場合はファミリーごとに評価し，
+// Targetの最初のIP(PodIP)のファミリーの結果を返す．ファミリーによって結果が異なる場合はFamiliesに全ての結果を入れる
+func (e *Engine) getAccess(fromPod v1.Pod, toPod v1.Pod, direction Direction) Access {
+	if access, ok := getNotApplicableAccess(fromPod, toPod, direction); ok {
+		return access
+	}
+
+	from, to := e.getEndpoint(fromPod), e.getEndpoint(toPod)
+	target, peer := to, from
+	if direction == DirectionEgress {
+		target, peer = from, to
+	}
+
+	// 両方のPodが持つファミリーをTargetのIPの順に並べる
+	families := make([]string, 0, 2)
+	for _, ip := range target.ips {
+		family := getIPFamily(ip)
+		if family != "" && len(filterIPsByFamily(peer.ips, family)) != 0 && !containsString(families, family) {
+			families = append(families, family)
+		}
+	}
+	switch len(families) {
+	case 0:
+		return Access{Explanations: []Explanation{newNoCommonFamilyExplanation(direction)}}
+	case 1:
+		// 共通するファミリーでしか通信できないので，ipBlock等の判定には両方ともそのファミリーのIPのみを使う
+		return e.getFamilyAccess(from, to, direction, families[0])
+	}
+
+	results := make([]FamilyAccess, 0, len(families))
+	for _, family := range families {
+		access := e.getFamilyAccess(from, to, direction, family)
+		results = append(results, FamilyAccess{
+			Family:       family,
+			Allowed:      access.Allowed,
+			Ports:        access.Ports,
+			Explanations: access.Explanations,
+		})
+	}
+
+	res := Access{
+		Allowed:      results[0].Allowed,
+		Ports:        results[0].Ports,
+		Explanations: results[0].Explanations,
+	}
+	for _, v := range results[1:] {
+		if v.Allowed != res.Allowed || !NewPortSet(v.Ports).Equal(NewPortSet(res.Ports)) {
+			res.Families = results
+			break
+		}
+	}
+	return res
+}
+
+// from, toのIPをfamilyのものに絞って通信の可否を求める
+func (e *Engine) getFamilyAccess(from endpoint, to endpoint, direction Direction, family string) Access {
+	from.ips = filterIPsByFamily(from.ips, family)
+	to.ips = filterIPsByFamily(to.ips, family)
+	return e.getEndpointAccess(from, to, direction)
+}
+
+// from, toの通信の可否を求める．directionがIngressならto，Egressならfromのpolicyを先に評価し，
+// 説明もその側を先に並べる
+func (e *Engine) getEndpointAccess(from endpoint, to endpoint, direction Direction) Access {
+	fromPod, toPod := from.pod, to.pod
+	first := func() sideResult {
+		return evaluateSide(e.getAppliedTiers(toPod, DirectionIngress), to, from, DirectionIngress)
+	}
+	second := func() sideResult {
+		return evaluateSide(e.getAppliedTiers(fromPod, DirectionEgress), from, to, DirectionEgress)
+	}
+	if direction == DirectionEgress {
+		first, second = second, first
+	}
+
+	targetSide := first()
+	res := Access{Explanations: targetSide.explanations}
+	if !targetSide.ok {
+		return res
+	}
+
+	// 今度は逆に相手Pod側のpolicyで通信が可能かチェックする
+	podSide := second()
+	if !podSide.ok {
+		res.Explanations = append(res.Explanations, toPeerBlockedExplanations(podSide.explanations)...)
+		return res
+	}
+	res.Explanations = append(res.Explanations, podSide.explanations...)
+
+	// お互いの許可するポートの積集合を取る
+	accessPorts := targetSide.ports.Intersect(podSide.ports)
+	if accessPorts.IsEmpty() {
+		res.Explanations = append(res.Explanations, newPortMismatchExplanation(direction))
+		return res
+	}
+
+	res.Allowed = true
+	res.Ports = accessPorts.Ports()
+	return res
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func isSamePod(a v1.Pod, b v1.Pod) bool {
+	return a.Namespace == b.Namespace && a.Name == b.Name
+}
+
+func getNamespaceMap(namespaceListItems []v1.Namespace) map[string]v1.Namespace {
+	m := make(map[string]v1.Namespace, len(namespaceListItems))
+	for _, v := range namespaceListItems {
+		m[v.Name] = v
+	}
+	return m
+}
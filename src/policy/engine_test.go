@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newTestPod(namespace string, name string, labels map[string]string, ips ...string) v1.Pod {
+	podIPs := make([]v1.PodIP, 0, len(ips))
+	for _, ip := range ips {
+		podIPs = append(podIPs, v1.PodIP{IP: ip})
+	}
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Status: v1.PodStatus{
+			Phase:      v1.PodRunning,
+			PodIP:      ips[0],
+			PodIPs:     podIPs,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+func TestCheckDualStack(t *testing.T) {
+	source := newTestPod("default", "source", map[string]string{"app": "source"}, "10.0.0.1", "fd00::1")
+	v4Dest := newTestPod("default", "v4-dest", map[string]string{"app": "dest"}, "10.0.0.2")
+	dualDest := newTestPod("default", "dual-dest", map[string]string{"app": "dest"}, "10.0.0.3", "fd00::3")
+	v6Dest := newTestPod("default", "v6-dest", map[string]string{"app": "dest"}, "fd00::4")
+	v4Source := newTestPod("default", "v4-source", map[string]string{"app": "source"}, "10.0.0.5")
+	namespaces := []v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "default"}}}
+
+	// 宛先はIPv6のipBlockからのingressのみ許可する
+	policies := []netv1.NetworkPolicy{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "allow-v6"},
+		Spec: netv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "dest"}},
+			Ingress: []netv1.NetworkPolicyIngressRule{{
+				From: []netv1.NetworkPolicyPeer{{IPBlock: &netv1.IPBlock{CIDR: "fd00::/64"}}},
+			}},
+		},
+	}}
+	engine := NewEngine([]v1.Pod{source, v4Dest, dualDest, v6Dest, v4Source}, namespaces, policies)
+
+	tests := []struct {
+		name         string
+		from         v1.Pod
+		to           v1.Pod
+		want         bool
+		wantReason   Reason
+		wantFamilies map[string]bool
+	}{
+		{
+			name:       "共通のファミリーがIPv4のみならIPv6のipBlockは使えない",
+			from:       source,
+			to:         v4Dest,
+			want:       false,
+			wantReason: ReasonNoRuleMatched,
+		},
+		{
+			// デュアルスタック同士はPodIPのファミリーの結果を返し，ファミリーごとの結果はFamiliesに入る
+			name:         "デュアルスタック同士はファミリーごとに評価する",
+			from:         source,
+			to:           dualDest,
+			want:         false,
+			wantFamilies: map[string]bool{IPFamilyIPv4: false, IPFamilyIPv6: true},
+		},
+		{
+			name: "共通のファミリーがIPv6のみ",
+			from: source,
+			to:   v6Dest,
+			want: true,
+		},
+		{
+			name:       "共通のファミリーがない",
+			from:       v4Source,
+			to:         v6Dest,
+			want:       false,
+			wantReason: ReasonNoCommonFamily,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, err := engine.Check(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if access.Allowed != tt.want {
+				t.Errorf("Check() = %v, want %v (%+v)", access.Allowed, tt.want, access.Explanations)
+			}
+			if len(access.Families) != len(tt.wantFamilies) {
+				t.Errorf("Check() families = %+v, want %v", access.Families, tt.wantFamilies)
+			}
+			for _, f := range access.Families {
+				if want, ok := tt.wantFamilies[f.Family]; !ok || f.Allowed != want {
+					t.Errorf("Check() family %s = %v, want %v", f.Family, f.Allowed, want)
+				}
+			}
+			if tt.wantReason == "" {
+				return
+			}
+			found := false
+			for _, e := range access.Explanations {
+				if e.Reason == tt.wantReason {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Check() explanations = %+v, want reason %q", access.Explanations, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestUnsupportedProtocolWarning(t *testing.T) {
+	client := newTestPod("default", "client", map[string]string{"app": "client"}, "10.0.0.1")
+	web := newTestPod("default", "web", map[string]string{"app": "web"}, "10.0.0.2")
+	namespaces := []v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "default"}}}
+	icmp := v1.Protocol("ICMP")
+	port := intstr.FromInt(80)
+
+	// ICMPのポートのみのルールはどの通信も許可しないが，policyはwebを隔離する
+	policies := []netv1.NetworkPolicy{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "icmp"},
+		Spec: netv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Ingress: []netv1.NetworkPolicyIngressRule{{
+				Ports: []netv1.NetworkPolicyPort{{Protocol: &icmp, Port: &port}},
+			}},
+		},
+	}}
+	engine := NewEngine([]v1.Pod{client, web}, namespaces, policies)
+
+	warnings := engine.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != WarningCodeUnsupportedProtocol || warnings[0].Field != "spec.ingress[0].ports[0].protocol" {
+		t.Errorf("Warnings() = %+v", warnings)
+	}
+	access, err := engine.Check(client, web)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if access.Allowed {
+		t.Errorf("Check() = %+v, want denied", access)
+	}
+}
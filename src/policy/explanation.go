@@ -0,0 +1,185 @@
+package policy
+
+import (
+	netv1 "k8s.io/api/networking/v1"
+	"strings"
+)
+
+type Direction string
+
+const (
+	DirectionIngress Direction = "Ingress"
+	DirectionEgress  Direction = "Egress"
+)
+
+type Reason string
+
+const (
+	// 通信元，通信先ともに同じPod
+	ReasonSelf Reason = "self"
+	// その方向についてPodを選択するpolicyがないので許可
+	ReasonNotIsolated Reason = "not_isolated"
+	// ルールにマッチしたので許可
+	ReasonRuleMatched Reason = "rule_matched"
+	// 拒否のルールにマッチした
+	ReasonRuleDenied Reason = "rule_denied"
+	// Passのルールにマッチしたので次の層で評価された
+	ReasonPassed Reason = "passed"
+	// 隔離されているがどのルールにもマッチしなかった
+	ReasonNoRuleMatched Reason = "no_rule_matched"
+	// 通信元Podのegressで拒否された
+	ReasonPeerEgressBlocked Reason = "peer_egress_blocked"
+	// 通信先Podのingressで拒否された
+	ReasonPeerIngressBlocked Reason = "peer_ingress_blocked"
+	// 双方のルールにはマッチしたが許可されたポートに共通部分がない
+	ReasonPortMismatch Reason = "port_mismatch"
+	// 起動していない，終了した等でIPを持たないPodとの通信なので評価しない
+	ReasonPodNotReady Reason = "pod_not_ready"
+	// hostNetworkのPodとの通信なので評価しない
+	ReasonHostNetwork Reason = "host_network"
+	// 二つのPodが同じアドレスファミリーのIPを持たないので通信できない
+	ReasonNoCommonFamily Reason = "no_common_family"
+)
+
+// Explanation は通信の許可，拒否の根拠．
+// Access.Explanationsのうち，Accessと同じDirectionのものはTarget側，逆のものは相手Pod側のpolicyによる判定
+type Explanation struct {
+	Direction Direction
+	// ルールを定義しているpolicyの種類(kubernetes, calico, cilium)と層(admin, default, baseline, Calicoのtier)
+	Engine          string
+	Tier            string
+	PolicyName      string
+	PolicyNamespace string
+	// ingress, egressルールのインデックス．該当しない場合は-1
+	RuleIndex int
+	// from, toのインデックス．該当しない(from, toが空)場合は-1
+	PeerIndex int
+	// マッチしたpeerの種類(namespaceSelector, podSelector, ipBlock, namespaceSelector+podSelector．Calico, Ciliumではselector, endpoints等)．from, toが空の場合はall
+	PeerType string
+	Reason   Reason
+}
+
+func newSelfExplanation(direction Direction) Explanation {
+	return Explanation{
+		Direction: direction,
+		RuleIndex: -1,
+		PeerIndex: -1,
+		Reason:    ReasonSelf,
+	}
+}
+
+func newNotIsolatedExplanation(direction Direction) Explanation {
+	return Explanation{
+		Direction: direction,
+		RuleIndex: -1,
+		PeerIndex: -1,
+		Reason:    ReasonNotIsolated,
+	}
+}
+
+func newRuleExplanation(direction Direction, source PolicySource, rule compiledRule, peerIndex int, peerType string) Explanation {
+	reason := ReasonRuleMatched
+	switch rule.action {
+	case ActionDeny:
+		reason = ReasonRuleDenied
+	case ActionPass:
+		reason = ReasonPassed
+	}
+
+	return Explanation{
+		Direction:       direction,
+		Engine:          source.Engine,
+		Tier:            source.Tier,
+		PolicyName:      source.Name,
+		PolicyNamespace: source.Namespace,
+		RuleIndex:       rule.index,
+		PeerIndex:       peerIndex,
+		PeerType:        peerType,
+		Reason:          reason,
+	}
+}
+
+func newPortMismatchExplanation(direction Direction) Explanation {
+	return Explanation{
+		Direction: direction,
+		RuleIndex: -1,
+		PeerIndex: -1,
+		Reason:    ReasonPortMismatch,
+	}
+}
+
+func newNotApplicableExplanation(direction Direction, state PodState) Explanation {
+	reason := ReasonPodNotReady
+	if state == PodStateHostNetwork {
+		reason = ReasonHostNetwork
+	}
+
+	return Explanation{
+		Direction: direction,
+		RuleIndex: -1,
+		PeerIndex: -1,
+		Reason:    reason,
+	}
+}
+
+func newNoCommonFamilyExplanation(direction Direction) Explanation {
+	return Explanation{
+		Direction: direction,
+		RuleIndex: -1,
+		PeerIndex: -1,
+		Reason:    ReasonNoCommonFamily,
+	}
+}
+
+// Podを隔離しているpolicyごとにどのルールにもマッチしなかったことを記録する
+func newNoRuleMatchedExplanations(direction Direction, policies []*compiledPolicy) []Explanation {
+	res := make([]Explanation, 0, len(policies))
+	for _, policy := range policies {
+		res = append(res, Explanation{
+			Direction:       direction,
+			Engine:          policy.source.Engine,
+			Tier:            policy.source.Tier,
+			PolicyName:      policy.source.Name,
+			PolicyNamespace: policy.source.Namespace,
+			RuleIndex:       -1,
+			PeerIndex:       -1,
+			Reason:          ReasonNoRuleMatched,
+		})
+	}
+	return res
+}
+
+// 相手Pod側のpolicyで拒否された場合は理由を付け替える
+func toPeerBlockedExplanations(explanations []Explanation) []Explanation {
+	res := make([]Explanation, 0, len(explanations))
+	for _, e := range explanations {
+		if e.Reason == ReasonNoRuleMatched {
+			if e.Direction == DirectionEgress {
+				e.Reason = ReasonPeerEgressBlocked
+			} else {
+				e.Reason = ReasonPeerIngressBlocked
+			}
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+func getPeerType(peer *netv1.NetworkPolicyPeer) string {
+	if peer == nil {
+		return "all"
+	}
+
+	if peer.IPBlock != nil {
+		return "ipBlock"
+	}
+
+	types := make([]string, 0, 2)
+	if peer.NamespaceSelector != nil {
+		types = append(types, "namespaceSelector")
+	}
+	if peer.PodSelector != nil {
+		types = append(types, "podSelector")
+	}
+	return strings.Join(types, "+")
+}
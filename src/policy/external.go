@@ -0,0 +1,304 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"net/netip"
+	"sort"
+)
+
+// ExternalPeer はクラスター外の通信相手．ipBlockのexceptを除き，許可されたポートが同じ範囲をまとめたもの
+type ExternalPeer struct {
+	// 範囲を最小の個数のCIDRで表したもの
+	CIDRs []string
+	// 許可されているポート．全ポートの場合は{Protocol: "any"}の一つ
+	Ports []Port
+	// 許可しているpolicy．隔離されていない場合は空
+	Policies []PolicySource
+}
+
+// ipRange はIPの[start, end]の閉区間．start, endは同じアドレスファミリー
+type ipRange struct {
+	start netip.Addr
+	end   netip.Addr
+}
+
+var allIPRanges = []ipRange{
+	prefixToRange(netip.MustParsePrefix("0.0.0.0/0")),
+	prefixToRange(netip.MustParsePrefix("::/0")),
+}
+
+func prefixToRange(prefix netip.Prefix) ipRange {
+	prefix = prefix.Masked()
+	start := prefix.Addr()
+	b := start.AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	end, _ := netip.AddrFromSlice(b)
+	return ipRange{start: start, end: end}
+}
+
+// ipBlockをexceptを除いたIPの範囲の一覧に直す．不正なCIDRは無視する(警告はvalidatePolicyで検出する)
+func ipBlockToRanges(ipBlock *netv1.IPBlock) []ipRange {
+	prefix, err := netip.ParsePrefix(ipBlock.CIDR)
+	if err != nil {
+		return nil
+	}
+
+	res := []ipRange{prefixToRange(prefix)}
+	for _, v := range ipBlock.Except {
+		except, err := netip.ParsePrefix(v)
+		if err != nil {
+			continue
+		}
+		res = subtractIPRange(res, prefixToRange(except))
+	}
+	return res
+}
+
+// CIDRの一覧をexceptを除いたIPの範囲の一覧に直す．単一のIPも指定できる．不正なCIDRは無視する(警告は各policyの変換時に出す)
+func cidrsToRanges(cidrs []string, excepts []string) []ipRange {
+	res := make([]ipRange, 0, len(cidrs))
+	for _, v := range cidrs {
+		if prefix, err := parseIPPrefix(v); err == nil {
+			res = append(res, prefixToRange(prefix))
+		}
+	}
+	for _, v := range excepts {
+		if except, err := parseIPPrefix(v); err == nil {
+			res = subtractIPRange(res, prefixToRange(except))
+		}
+	}
+	return res
+}
+
+func parseIPPrefix(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return netip.ParsePrefix(s)
+}
+
+func subtractIPRange(ranges []ipRange, except ipRange) []ipRange {
+	res := make([]ipRange, 0, len(ranges)+1)
+	for _, r := range ranges {
+		if r.start.Is4() != except.start.Is4() || except.end.Less(r.start) || r.end.Less(except.start) {
+			res = append(res, r)
+			continue
+		}
+		if r.start.Less(except.start) {
+			res = append(res, ipRange{start: r.start, end: except.start.Prev()})
+		}
+		if except.end.Less(r.end) {
+			res = append(res, ipRange{start: except.end.Next(), end: r.end})
+		}
+	}
+	return res
+}
+
+// 範囲を最小の個数のCIDRで表す
+func rangeToPrefixes(r ipRange) []netip.Prefix {
+	res := make([]netip.Prefix, 0)
+	start := r.start
+	for {
+		// startから始まり範囲に収まる最大のCIDRを探す
+		bits := start.BitLen()
+		for bits > 0 {
+			p, _ := start.Prefix(bits - 1)
+			if p.Addr() != start || r.end.Less(prefixToRange(p).end) {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(start, bits)
+		res = append(res, p)
+
+		last := prefixToRange(p).end
+		if last == r.end || !last.Next().IsValid() {
+			return res
+		}
+		start = last.Next()
+	}
+}
+
+// クラスター外のIPの範囲にマッチするルール
+type externalRule struct {
+	ranges []ipRange
+	action Action
+	ports  PortSet
+	source PolicySource
+}
+
+func (r externalRule) contains(addr netip.Addr) bool {
+	for _, v := range r.ranges {
+		if v.start.Is4() == addr.Is4() && !addr.Less(v.start) && !v.end.Less(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 評価順に並べた層ごとのクラスター外へのルール
+type externalTier struct {
+	rules       []externalRule
+	defaultDeny bool
+}
+
+// getExternalPeers はtargetPodとクラスター外との間で許可されている通信を求める．
+// evaluateSideと同じく層を順に評価し，IPの範囲とポートごとに最初にマッチしたルールの動作に従う
+func (e *Engine) getExternalPeers(targetPod v1.Pod, direction Direction) []ExternalPeer {
+	if !ClassifyPod(targetPod).IsApplicable() {
+		return []ExternalPeer{}
+	}
+
+	// 名前付きポートはingressではtargetPodで解決する．egressでは通信先がPodではないので解決できない
+	dest := v1.Pod{}
+	if direction == DirectionIngress {
+		dest = targetPod
+	}
+
+	tiers := make([]externalTier, 0)
+	for _, t := range e.getAppliedTiers(targetPod, direction) {
+		tier := externalTier{defaultDeny: t.defaultDeny}
+		for _, policy := range t.policies {
+			for _, rule := range policy.rules(direction) {
+				if len(rule.externalRanges) == 0 {
+					continue
+				}
+				ports := rule.ports(dest)
+				if ports.IsEmpty() {
+					continue
+				}
+				tier.rules = append(tier.rules, externalRule{ranges: rule.externalRanges, action: rule.action, ports: ports, source: policy.source})
+			}
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return evaluateExternalTiers(tiers)
+}
+
+// ルールの範囲で全てのIPを重なりのない区間に分け，区間ごとに許可されるポートを求める．隣接する区間でポートが同じものはまとめる
+func evaluateExternalTiers(tiers []externalTier) []ExternalPeer {
+	// 区間の境界の一覧
+	boundaries := make([]netip.Addr, 0)
+	addBoundaries := func(ranges []ipRange) {
+		for _, r := range ranges {
+			boundaries = append(boundaries, r.start)
+			if next := r.end.Next(); next.IsValid() {
+				boundaries = append(boundaries, next)
+			}
+		}
+	}
+	addBoundaries(allIPRanges)
+	for _, t := range tiers {
+		for _, rule := range t.rules {
+			addBoundaries(rule.ranges)
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Less(boundaries[j])
+	})
+	unique := boundaries[:0]
+	for i, v := range boundaries {
+		if i == 0 || boundaries[i-1] != v {
+			unique = append(unique, v)
+		}
+	}
+	boundaries = unique
+
+	type segment struct {
+		r       ipRange
+		ports   PortSet
+		sources []PolicySource
+	}
+	segments := make([]segment, 0)
+	for i, start := range boundaries {
+		// 次の境界の手前まで．ファミリーの最後の区間はファミリーの最後のアドレスまで
+		end := prefixToRange(netip.PrefixFrom(start, 0)).end
+		if i+1 < len(boundaries) && boundaries[i+1].Is4() == start.Is4() {
+			end = boundaries[i+1].Prev()
+		}
+
+		ports, sources := evaluateExternalAddr(tiers, start)
+		if ports.IsEmpty() {
+			continue
+		}
+
+		if n := len(segments); n > 0 {
+			prev := &segments[n-1]
+			if prev.r.end.Next() == start && prev.ports.Equal(ports) {
+				prev.r.end = end
+				for _, source := range sources {
+					if !containsPolicySource(prev.sources, source) {
+						prev.sources = append(prev.sources, source)
+					}
+				}
+				continue
+			}
+		}
+		segments = append(segments, segment{r: ipRange{start: start, end: end}, ports: ports, sources: sources})
+	}
+
+	res := make([]ExternalPeer, 0, len(segments))
+	for _, s := range segments {
+		cidrs := make([]string, 0)
+		for _, p := range rangeToPrefixes(s.r) {
+			cidrs = append(cidrs, p.String())
+		}
+		res = append(res, ExternalPeer{CIDRs: cidrs, Ports: s.ports.Ports(), Policies: s.sources})
+	}
+	return res
+}
+
+// addrとの通信で許可されるポートと，許可したpolicyを求める．
+// Denyはポートを除き，Passは次の層で評価し，隔離する層でどのルールにもマッチしなかったポートは拒否する
+func evaluateExternalAddr(tiers []externalTier, addr netip.Addr) (PortSet, []PolicySource) {
+	allowed := EmptyPortSet()
+	sources := make([]PolicySource, 0)
+	remaining := AllPortSet()
+	for _, t := range tiers {
+		passed := EmptyPortSet()
+		for _, rule := range t.rules {
+			if remaining.IsEmpty() {
+				break
+			}
+			if !rule.contains(addr) {
+				continue
+			}
+			ports := rule.ports.Intersect(remaining)
+			if ports.IsEmpty() {
+				continue
+			}
+
+			switch rule.action {
+			case ActionAllow:
+				allowed = allowed.Union(ports)
+				if !containsPolicySource(sources, rule.source) {
+					sources = append(sources, rule.source)
+				}
+			case ActionPass:
+				passed = passed.Union(ports)
+			}
+			remaining = remaining.Subtract(ports)
+		}
+
+		if t.defaultDeny {
+			remaining = EmptyPortSet()
+		}
+		remaining = remaining.Union(passed)
+	}
+
+	// どの層でも決まらなかった通信は許可
+	return allowed.Union(remaining), sources
+}
+
+func containsPolicySource(list []PolicySource, source PolicySource) bool {
+	for _, v := range list {
+		if v == source {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"net/netip"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// peersのいずれかのCIDRにaddrが含まれるか
+func externalPeersContain(peers []ExternalPeer, addr string) bool {
+	a := netip.MustParseAddr(addr)
+	for _, peer := range peers {
+		for _, cidr := range peer.CIDRs {
+			if netip.MustParsePrefix(cidr).Contains(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestGetExternalPeers(t *testing.T) {
+	pod := newTestPod("default", "web", map[string]string{"app": "web"}, "10.0.0.1")
+	namespaces := []v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "default"}}}
+	securityOrder := 100.0
+
+	tests := []struct {
+		name        string
+		policySet   PolicySet
+		wantAllowed []string
+		wantDenied  []string
+	}{
+		{
+			name:        "隔離されていなければ全て許可",
+			policySet:   PolicySet{},
+			wantAllowed: []string{"1.2.3.4", "8.8.8.8", "2001:db8::1"},
+		},
+		{
+			name: "AdminNetworkPolicyのDenyは隔離しない層でも範囲を除く",
+			policySet: PolicySet{AdminNetworkPolicies: []AdminNetworkPolicy{{
+				Name: "deny-v4",
+				Spec: AdminNetworkPolicySpec{
+					Subject: AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+					Egress: []AdminNetworkPolicyRule{{
+						Action: "Deny",
+						To:     []AdminNetworkPolicyPeer{{Networks: []string{"0.0.0.0/0"}}},
+					}},
+				},
+			}}},
+			wantAllowed: []string{"2001:db8::1"},
+			wantDenied:  []string{"1.2.3.4", "8.8.8.8"},
+		},
+		{
+			name: "CalicoのDenyは後のAllowより優先する",
+			policySet: PolicySet{CalicoPolicies: []CalicoPolicy{{
+				Name:      "deny-then-allow",
+				Namespace: "default",
+				Spec: CalicoPolicySpec{
+					Selector: "all()",
+					Types:    []string{"Egress"},
+					Egress: []CalicoRule{
+						{Action: "Deny", Destination: CalicoEntityRule{Nets: []string{"1.2.3.0/24"}}},
+						{Action: "Allow"},
+					},
+				},
+			}}},
+			wantAllowed: []string{"1.2.2.255", "1.2.4.0", "8.8.8.8", "2001:db8::1"},
+			wantDenied:  []string{"1.2.3.0", "1.2.3.255"},
+		},
+		{
+			name: "CalicoのPassは次の層で評価する",
+			policySet: PolicySet{
+				CalicoTiers: []CalicoTier{{Name: "security", Order: &securityOrder}},
+				CalicoPolicies: []CalicoPolicy{
+					{
+						Name:      "pass",
+						Namespace: "default",
+						Spec: CalicoPolicySpec{
+							Tier:     "security",
+							Selector: "all()",
+							Types:    []string{"Egress"},
+							Egress: []CalicoRule{
+								{Action: "Pass", Destination: CalicoEntityRule{Nets: []string{"1.2.3.0/24"}}},
+								{Action: "Deny"},
+							},
+						},
+					},
+					{
+						Name:      "allow",
+						Namespace: "default",
+						Spec: CalicoPolicySpec{
+							Selector: "all()",
+							Types:    []string{"Egress"},
+							Egress:   []CalicoRule{{Action: "Allow"}},
+						},
+					},
+				},
+			},
+			wantAllowed: []string{"1.2.3.4"},
+			wantDenied:  []string{"8.8.8.8", "2001:db8::1"},
+		},
+		{
+			name: "CiliumのegressDenyはworldへの許可より優先する",
+			policySet: PolicySet{CiliumPolicies: []CiliumPolicy{{
+				Name:      "world",
+				Namespace: "default",
+				Specs: []CiliumRule{{
+					EndpointSelector: &metav1.LabelSelector{},
+					Egress:           []CiliumEgressRule{{ToEntities: []string{"world"}}},
+					EgressDeny:       []CiliumEgressRule{{ToCIDR: []string{"1.2.3.0/24"}}},
+				}},
+			}}},
+			wantAllowed: []string{"1.2.2.255", "8.8.8.8", "2001:db8::1"},
+			wantDenied:  []string{"1.2.3.4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngineWithPolicySet([]v1.Pod{pod}, namespaces, tt.policySet)
+			peers := engine.getExternalPeers(pod, DirectionEgress)
+			for _, addr := range tt.wantAllowed {
+				if !externalPeersContain(peers, addr) {
+					t.Errorf("getExternalPeers() = %+v, want %s allowed", peers, addr)
+				}
+			}
+			for _, addr := range tt.wantDenied {
+				if externalPeersContain(peers, addr) {
+					t.Errorf("getExternalPeers() = %+v, want %s denied", peers, addr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,470 @@
+package policy
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net"
+	"net/netip"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Finding はNetwork Policyの記述についての指摘
+type Finding struct {
+	Severity   Severity
+	Code       string
+	PolicyName string
+	Namespace  string
+	// 指摘箇所のパス(例: spec.ingress[0].from[1].ipBlock.cidr)
+	Field   string
+	Message string
+}
+
+// ルールの包含関係を調べるための，ルールの記述から求めたselector, IPの範囲, ポートの集合．
+// 現在のPodの集合にはよらず，記述の上で含まれる場合だけ包含とみなす
+type lintRule struct {
+	policyIndex int
+	field       string
+	isIngress   bool
+	podSelector *metav1.LabelSelector
+	// from, toが空で全ての通信相手を許可する
+	allPeers bool
+	// podSelector, namespaceSelectorのpeer
+	peers []lintPeer
+	// ipBlockのpeerのexceptを除いた範囲の和
+	ipRanges []ipRange
+	// 数値で指定されたポート
+	ports      PortSet
+	namedPorts []namedPort
+	// 解析できないselector, CIDRを含み比較できない
+	incomparable bool
+	// PodSelectorMatchesNoPod, PeerMatchesNothingで指摘済み
+	reported bool
+}
+
+// namespaceSelectorがnilのpeerはpolicyのnamespaceのPodを表す．podSelectorのnilは全てのPod
+type lintPeer struct {
+	namespaceSelector *metav1.LabelSelector
+	podSelector       *metav1.LabelSelector
+}
+
+type namedPort struct {
+	protocol string
+	name     string
+}
+
+// Lint は全てのNetwork Policyを検査して指摘の一覧を返す
+func (e *Engine) Lint() []Finding {
+	findings := make([]Finding, 0)
+	for _, w := range e.warnings {
+		findings = append(findings, Finding{
+			Severity:   SeverityError,
+			Code:       w.Code,
+			PolicyName: w.PolicyName,
+			Namespace:  w.Namespace,
+			Field:      w.Field,
+			Message:    w.Message,
+		})
+	}
+
+	// ルールの包含関係はnamespaceごとに調べる
+	namespaces := make([]string, 0)
+	rulesByNamespace := make(map[string][]lintRule)
+	for i, policy := range e.policies {
+		add := func(severity Severity, code string, field string, message string) {
+			findings = append(findings, Finding{
+				Severity:   severity,
+				Code:       code,
+				PolicyName: policy.Name,
+				Namespace:  policy.Namespace,
+				Field:      field,
+				Message:    message,
+			})
+		}
+
+		if _, ok := rulesByNamespace[policy.Namespace]; !ok {
+			namespaces = append(namespaces, policy.Namespace)
+			rulesByNamespace[policy.Namespace] = make([]lintRule, 0)
+		}
+
+		selectedPods := make([]bool, len(e.pods))
+		hasSelectedPod := false
+		for j, pod := range e.pods {
+			if pod.Namespace == policy.Namespace && isIncludedInLabelSelector(pod.Labels, &policy.Spec.PodSelector) {
+				selectedPods[j] = true
+				hasSelectedPod = true
+			}
+		}
+		// 不正なpodSelectorはvalidatePolicyの警告で指摘済み
+		if !hasSelectedPod && isValidLabelSelector(&policy.Spec.PodSelector) {
+			add(SeverityWarning, "PodSelectorMatchesNoPod", "spec.podSelector", "podSelector matches no pod")
+		}
+
+		policyTypes := getPolicyTypes(policy)
+		if hasIngress(policyTypes) {
+			for j, rule := range policy.Spec.Ingress {
+				field := fmt.Sprintf("spec.ingress[%d]", j)
+				r := e.lintRule(add, i, field, policy, selectedPods, rule.From, "from", rule.Ports, true)
+				r.reported = r.reported || !hasSelectedPod
+				rulesByNamespace[policy.Namespace] = append(rulesByNamespace[policy.Namespace], r)
+			}
+		}
+		if hasEgress(policyTypes) {
+			for j, rule := range policy.Spec.Egress {
+				field := fmt.Sprintf("spec.egress[%d]", j)
+				r := e.lintRule(add, i, field, policy, selectedPods, rule.To, "to", rule.Ports, false)
+				r.reported = r.reported || !hasSelectedPod
+				rulesByNamespace[policy.Namespace] = append(rulesByNamespace[policy.Namespace], r)
+			}
+		}
+	}
+
+	for _, namespace := range namespaces {
+		findings = append(findings, e.lintShadowedRules(namespace, rulesByNamespace[namespace])...)
+	}
+
+	return findings
+}
+
+// ルール一つ分のpeer, portを検査し，包含関係を調べるための集合を作る
+func (e *Engine) lintRule(add func(Severity, string, string, string), policyIndex int, field string, policy netv1.NetworkPolicy, selectedPods []bool, peers []netv1.NetworkPolicyPeer, peerField string, ports []netv1.NetworkPolicyPort, isIngress bool) lintRule {
+	r := lintRule{
+		policyIndex: policyIndex,
+		field:       field,
+		isIngress:   isIngress,
+		podSelector: &policy.Spec.PodSelector,
+		allPeers:    len(peers) == 0,
+		peers:       make([]lintPeer, 0, len(peers)),
+		ipRanges:    make([]ipRange, 0),
+		ports:       EmptyPortSet(),
+		namedPorts:  make([]namedPort, 0),
+	}
+	if !isValidLabelSelector(r.podSelector) {
+		r.incomparable = true
+	}
+
+	peerPods := make([]bool, len(e.pods))
+	for i, peer := range peers {
+		peerPath := fmt.Sprintf("%s.%s[%d]", field, peerField, i)
+		if peer.IPBlock != nil {
+			if !isValidIpBlock(peer.IPBlock) {
+				r.incomparable = true
+			}
+			r.ipRanges = append(r.ipRanges, ipBlockToRanges(peer.IPBlock)...)
+			for _, f := range lintIpBlock(peer.IPBlock) {
+				add(SeverityError, f.Code, peerPath+".ipBlock"+f.Field, f.Message)
+			}
+			continue
+		}
+
+		r.peers = append(r.peers, lintPeer{namespaceSelector: peer.NamespaceSelector, podSelector: peer.PodSelector})
+		validPeer := isValidLabelSelector(peer.NamespaceSelector) && isValidLabelSelector(peer.PodSelector)
+		if !validPeer {
+			r.incomparable = true
+		}
+		matched := false
+		for j, pod := range e.pods {
+			isIncluded, _ := isIncludedInPeer(e.getEndpoint(pod), policy.Namespace, peer)
+			if isIncluded {
+				peerPods[j] = true
+				matched = true
+			}
+		}
+		if !matched && validPeer {
+			add(SeverityWarning, "PeerMatchesNothing", peerPath, "peer selectors match no pod")
+			r.reported = true
+		}
+	}
+
+	for i, port := range ports {
+		portPath := fmt.Sprintf("%s.ports[%d]", field, i)
+		if port.EndPort != nil {
+			switch {
+			case port.Port == nil:
+				add(SeverityError, "EndPortWithoutPort", portPath+".endPort", "endPort is set without port")
+			case port.Port.Type == intstr.String:
+				add(SeverityError, "EndPortWithNamedPort", portPath+".endPort", "endPort cannot be used with a named port")
+			case int(*port.EndPort) < port.Port.IntValue():
+				add(SeverityError, "EndPortBeforePort", portPath+".endPort", fmt.Sprintf("endPort %d is smaller than port %d", *port.EndPort, port.Port.IntValue()))
+			}
+		}
+
+		// 未対応のprotocolのポートは評価でも除外される(警告はvalidatePolicyPortsで出す)
+		if port.Port == nil || port.Port.Type == intstr.Int {
+			if p, ok := castPort(port); ok {
+				r.ports = r.ports.Union(NewPortSet([]Port{p}))
+			}
+			continue
+		}
+		protocol, ok := castProtocol(port.Protocol)
+		if !ok {
+			continue
+		}
+
+		r.namedPorts = append(r.namedPorts, namedPort{protocol: protocol, name: port.Port.StrVal})
+
+		// ingressはpolicyに選択されたPod，egressは通信先のPodで名前を解決する
+		destPods := peerPods
+		if isIngress {
+			destPods = selectedPods
+		} else if r.allPeers {
+			destPods = nil
+		}
+		if !e.resolvesOnAnyPod(port.Port.StrVal, port.Protocol, destPods) {
+			add(SeverityWarning, "UnresolvedNamedPort", portPath+".port", fmt.Sprintf("named port %q does not resolve on any destination pod", port.Port.StrVal))
+		}
+	}
+
+	if len(ports) == 0 {
+		// ポート指定なしは全ポート許可
+		r.ports = AllPortSet()
+	}
+	return r
+}
+
+// 名前付きポートがdestPodsのいずれかで解決できるか．destPodsがnilの場合は全Pod
+func (e *Engine) resolvesOnAnyPod(name string, protocol *v1.Protocol, destPods []bool) bool {
+	for i, pod := range e.pods {
+		if destPods != nil && !destPods[i] {
+			continue
+		}
+		if _, ok := resolveNamedPort(name, protocol, pod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 同じnamespaceの別のルールに記述の上で完全に含まれるルールを探す．互いに含み合う場合は後ろのものだけを指摘する．
+// 既にPodSelectorMatchesNoPod, PeerMatchesNothingで指摘したルールは除く
+func (e *Engine) lintShadowedRules(namespace string, rules []lintRule) []Finding {
+	findings := make([]Finding, 0)
+	for i, r := range rules {
+		if r.incomparable || r.reported {
+			continue
+		}
+
+		for j, other := range rules {
+			if i == j || r.isIngress != other.isIngress || other.incomparable {
+				continue
+			}
+			if !isShadowedBy(namespace, r, other) {
+				continue
+			}
+			if j > i && isShadowedBy(namespace, other, r) {
+				// 同じ内容のルールは後ろのものを指摘する
+				continue
+			}
+
+			policy := e.policies[r.policyIndex]
+			otherPolicy := e.policies[other.policyIndex]
+			findings = append(findings, Finding{
+				Severity:   SeverityInfo,
+				Code:       "ShadowedRule",
+				PolicyName: policy.Name,
+				Namespace:  policy.Namespace,
+				Field:      r.field,
+				Message:    fmt.Sprintf("rule is fully covered by %s in policy %q", other.field, otherPolicy.Name),
+			})
+			break
+		}
+	}
+	return findings
+}
+
+// rの許可する通信がotherの許可する通信に含まれるか
+func isShadowedBy(namespace string, r lintRule, other lintRule) bool {
+	if !isLabelSelectorSubset(r.podSelector, other.podSelector) {
+		return false
+	}
+
+	if !other.allPeers {
+		if r.allPeers {
+			return false
+		}
+		for _, peer := range r.peers {
+			if !isPeerCoveredBy(namespace, peer, other.peers) {
+				return false
+			}
+		}
+		if !isIPRangeSubset(r.ipRanges, other.ipRanges) {
+			return false
+		}
+	}
+
+	if !r.ports.Subtract(other.ports).IsEmpty() {
+		return false
+	}
+	for _, p := range r.namedPorts {
+		if !containsNamedPort(other.namedPorts, p) && !NewPortSet([]Port{{Protocol: p.protocol}}).Subtract(other.ports).IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// peerがothersのいずれかに含まれるか
+func isPeerCoveredBy(namespace string, peer lintPeer, others []lintPeer) bool {
+	// namespaceSelectorがnilのpeerはpolicyのnamespaceを名前で選択するのと同じ
+	peerNamespaceSelector := peer.namespaceSelector
+	if peerNamespaceSelector == nil {
+		peerNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{v1.LabelMetadataName: namespace}}
+	}
+
+	for _, other := range others {
+		if other.namespaceSelector == nil {
+			if peer.namespaceSelector != nil {
+				continue
+			}
+		} else if !isLabelSelectorSubset(peerNamespaceSelector, other.namespaceSelector) {
+			continue
+		}
+		if isLabelSelectorSubset(peer.podSelector, other.podSelector) {
+			return true
+		}
+	}
+	return false
+}
+
+// aにマッチするラベルが必ずbにもマッチするか．bの各条件がaのいずれかの条件から導ける場合だけtrueを返す．nilは全てにマッチする
+func isLabelSelectorSubset(a *metav1.LabelSelector, b *metav1.LabelSelector) bool {
+	aRequirements := labelSelectorRequirements(a)
+	for _, br := range labelSelectorRequirements(b) {
+		implied := false
+		for _, ar := range aRequirements {
+			if isRequirementImplied(ar, br) {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLabelsをInの条件に直してmatchExpressionsとまとめる
+func labelSelectorRequirements(selector *metav1.LabelSelector) []metav1.LabelSelectorRequirement {
+	if selector == nil {
+		return nil
+	}
+
+	res := make([]metav1.LabelSelectorRequirement, 0, len(selector.MatchLabels)+len(selector.MatchExpressions))
+	for k, v := range selector.MatchLabels {
+		res = append(res, metav1.LabelSelectorRequirement{Key: k, Operator: metav1.LabelSelectorOpIn, Values: []string{v}})
+	}
+	return append(res, selector.MatchExpressions...)
+}
+
+// 条件aを満たすラベルが必ず条件bを満たすか
+func isRequirementImplied(a metav1.LabelSelectorRequirement, b metav1.LabelSelectorRequirement) bool {
+	if a.Key != b.Key {
+		return false
+	}
+
+	switch b.Operator {
+	case metav1.LabelSelectorOpIn:
+		return a.Operator == metav1.LabelSelectorOpIn && isStringSubset(a.Values, b.Values)
+	case metav1.LabelSelectorOpNotIn:
+		switch a.Operator {
+		case metav1.LabelSelectorOpIn:
+			for _, v := range a.Values {
+				if containsString(b.Values, v) {
+					return false
+				}
+			}
+			return true
+		case metav1.LabelSelectorOpNotIn:
+			return isStringSubset(b.Values, a.Values)
+		case metav1.LabelSelectorOpDoesNotExist:
+			return true
+		}
+	case metav1.LabelSelectorOpExists:
+		return a.Operator == metav1.LabelSelectorOpIn || a.Operator == metav1.LabelSelectorOpExists
+	case metav1.LabelSelectorOpDoesNotExist:
+		return a.Operator == metav1.LabelSelectorOpDoesNotExist
+	}
+	return false
+}
+
+// aの範囲がbの範囲の和に含まれるか
+func isIPRangeSubset(a []ipRange, b []ipRange) bool {
+	rest := a
+	for _, r := range b {
+		rest = subtractIPRange(rest, r)
+	}
+	return len(rest) == 0
+}
+
+func isValidLabelSelector(selector *metav1.LabelSelector) bool {
+	if selector == nil {
+		return true
+	}
+	_, err := metav1.LabelSelectorAsSelector(selector)
+	return err == nil
+}
+
+func isValidIpBlock(ipBlock *netv1.IPBlock) bool {
+	if _, err := netip.ParsePrefix(ipBlock.CIDR); err != nil {
+		return false
+	}
+	for _, except := range ipBlock.Except {
+		if _, err := netip.ParsePrefix(except); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func containsNamedPort(list []namedPort, p namedPort) bool {
+	for _, v := range list {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+func isStringSubset(a []string, b []string) bool {
+	for _, v := range a {
+		if !containsString(b, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// ipBlockのexceptがcidrに含まれるか検査する．Fieldは".except[0]"などipBlockからの相対パス．
+// 解析できないcidr, exceptはWarningとして指摘済み
+func lintIpBlock(ipBlock *netv1.IPBlock) []Finding {
+	findings := make([]Finding, 0)
+	_, cidrNet, err := net.ParseCIDR(ipBlock.CIDR)
+	if err != nil {
+		return findings
+	}
+
+	cidrOnes, _ := cidrNet.Mask.Size()
+	for i, except := range ipBlock.Except {
+		field := fmt.Sprintf(".except[%d]", i)
+		exceptIP, exceptNet, err := net.ParseCIDR(except)
+		if err != nil {
+			continue
+		}
+
+		exceptOnes, _ := exceptNet.Mask.Size()
+		if !cidrNet.Contains(exceptIP) || exceptOnes <= cidrOnes {
+			findings = append(findings, Finding{Code: "ExceptOutsideCIDR", Field: field, Message: fmt.Sprintf("except %s is not strictly within cidr %s", except, ipBlock.CIDR)})
+		}
+	}
+	return findings
+}
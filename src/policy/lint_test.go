@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestLint(t *testing.T) {
+	web := newTestPod("default", "web", map[string]string{"app": "web"}, "10.0.0.1")
+	namespaces := []v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "default"}}}
+	invalidSelector := metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "app", Operator: metav1.LabelSelectorOpIn},
+	}}
+	port80 := intstr.FromInt(80)
+
+	tests := []struct {
+		name  string
+		spec  netv1.NetworkPolicySpec
+		codes []string
+	}{
+		{
+			name: "podSelectorにマッチするPodがない",
+			spec: netv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			},
+			codes: []string{"PodSelectorMatchesNoPod"},
+		},
+		{
+			name:  "不正なpodSelectorはPodSelectorMatchesNoPodを重ねて指摘しない",
+			spec:  netv1.NetworkPolicySpec{PodSelector: invalidSelector},
+			codes: []string{WarningCodeInvalidSelector},
+		},
+		{
+			name: "不正なpeerはPeerMatchesNothingを重ねて指摘しない",
+			spec: netv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Ingress: []netv1.NetworkPolicyIngressRule{{
+					From: []netv1.NetworkPolicyPeer{{PodSelector: &invalidSelector}},
+				}},
+			},
+			codes: []string{WarningCodeInvalidSelector},
+		},
+		{
+			name: "全てを許可するルールの後のルールは包含される",
+			spec: netv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				Ingress: []netv1.NetworkPolicyIngressRule{
+					{},
+					{
+						From:  []netv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+						Ports: []netv1.NetworkPolicyPort{{Port: &port80}},
+					},
+				},
+			},
+			codes: []string{"ShadowedRule"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies := []netv1.NetworkPolicy{{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "p"}, Spec: tt.spec}}
+			engine := NewEngine([]v1.Pod{web}, namespaces, policies)
+			codes := make([]string, 0)
+			for _, f := range engine.Lint() {
+				codes = append(codes, f.Code)
+			}
+			sort.Strings(codes)
+			if !reflect.DeepEqual(codes, tt.codes) {
+				t.Errorf("Lint() = %v, want %v", codes, tt.codes)
+			}
+		})
+	}
+}
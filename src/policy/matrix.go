@@ -0,0 +1,47 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// Matrix はPod同士の通信可否の一覧．許可されている組のみを持つ
+type Matrix struct {
+	Pods  []v1.Pod
+	Cells []MatrixCell
+}
+
+// MatrixCell はPods[From]からPods[To]への通信が許可されていること
+type MatrixCell struct {
+	From int
+	To   int
+	// 許可されているポート．全ポートの場合は{Protocol: "any"}の一つ
+	Ports []Port
+}
+
+// Matrix はpods内の全ての組について通信可否を評価する．Podごとの適用policyの選択は一度だけ行う
+func (e *Engine) Matrix(pods []v1.Pod) (Matrix, error) {
+	res := Matrix{
+		Pods:  pods,
+		Cells: make([]MatrixCell, 0, len(pods)),
+	}
+
+	for from, fromPod := range pods {
+		for to, toPod := range pods {
+			access, err := e.Check(fromPod, toPod)
+			if err != nil {
+				return Matrix{}, err
+			}
+			if !access.Allowed {
+				continue
+			}
+
+			res.Cells = append(res.Cells, MatrixCell{
+				From:  from,
+				To:    to,
+				Ports: access.Ports,
+			})
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// PodState はNetwork Policyの評価対象になるかどうかの観点でのPodの状態
+type PodState string
+
+const (
+	PodStateRunning PodState = "running"
+	// IPが割り当てられていない
+	PodStatePending     PodState = "pending"
+	PodStateTerminating PodState = "terminating"
+	// ノードのIPを共有しており，Network Policyの対象にならない
+	PodStateHostNetwork PodState = "hostNetwork"
+	// SucceededまたはFailedで終了している
+	PodStateCompleted PodState = "completed"
+)
+
+// ClassifyPod はPodの状態を判定する
+func ClassifyPod(pod v1.Pod) PodState {
+	switch {
+	case pod.DeletionTimestamp != nil:
+		return PodStateTerminating
+	case pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed:
+		return PodStateCompleted
+	case pod.Status.Phase == v1.PodPending || len(GetPodIPs(pod)) == 0:
+		return PodStatePending
+	case pod.Spec.HostNetwork:
+		return PodStateHostNetwork
+	default:
+		return PodStateRunning
+	}
+}
+
+// IsApplicable はPodの通信がNetwork Policyで評価できるかを返す
+func (s PodState) IsApplicable() bool {
+	return s == PodStateRunning
+}
+
+// 通信元，通信先のどちらかが評価できない状態の場合はその理由を返す
+func getNotApplicableAccess(fromPod v1.Pod, toPod v1.Pod, direction Direction) (Access, bool) {
+	// Target側を先に判定する
+	pods := []v1.Pod{toPod, fromPod}
+	if direction == DirectionEgress {
+		pods = []v1.Pod{fromPod, toPod}
+	}
+
+	for _, pod := range pods {
+		state := ClassifyPod(pod)
+		if state.IsApplicable() {
+			continue
+		}
+		return Access{Explanations: []Explanation{newNotApplicableExplanation(direction, state)}}, true
+	}
+	return Access{}, false
+}
@@ -0,0 +1,123 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// AllowsPort は許可されたポート一覧にprotocol, portの通信が含まれるか判定する．portが0の場合はいずれかのポートが許可されていればよい
+func (a Access) AllowsPort(protocol string, port int) bool {
+	if !a.Allowed {
+		return false
+	}
+
+	return NewPortSet(a.Ports).Contains(protocol, port)
+}
+
+// ルールのポート一覧をポートの集合に直す．名前付きポートは通信先Podのコンテナポートで解決し，解決できないものと未対応のprotocolのものは除外する．
+// ルールにポートの指定があるのに一つも解決できなかった場合はfalseを返す
+func resolvePolicyPorts(ports []netv1.NetworkPolicyPort, destPod v1.Pod) (PortSet, bool) {
+	if len(ports) == 0 {
+		// ポート指定なしは全ポート許可
+		return AllPortSet(), true
+	}
+
+	res := make([]Port, 0, len(ports))
+	for _, p := range ports {
+		if p.Port == nil || p.Port.Type == intstr.Int {
+			if port, ok := castPort(p); ok {
+				res = append(res, port)
+			}
+			continue
+		}
+
+		protocol, ok := castProtocol(p.Protocol)
+		if !ok {
+			continue
+		}
+		portNumber, ok := resolveNamedPort(p.Port.StrVal, p.Protocol, destPod)
+		if !ok {
+			continue
+		}
+		res = append(res, Port{
+			Protocol: protocol,
+			Port:     portNumber,
+			Name:     p.Port.StrVal,
+		})
+	}
+
+	if len(res) == 0 {
+		return EmptyPortSet(), false
+	}
+	return NewPortSet(res), true
+}
+
+// 名前付きポートをPodのコンテナポートから探す．protocolの指定がない場合はTCPとして扱う
+func resolveNamedPort(name string, protocol *v1.Protocol, pod v1.Pod) (int, bool) {
+	policyProtocol := v1.ProtocolTCP
+	if protocol != nil {
+		policyProtocol = *protocol
+	}
+
+	for _, container := range pod.Spec.Containers {
+		for _, containerPort := range container.Ports {
+			containerProtocol := containerPort.Protocol
+			if containerProtocol == "" {
+				containerProtocol = v1.ProtocolTCP
+			}
+			if containerPort.Name == name && containerProtocol == policyProtocol {
+				return int(containerPort.ContainerPort), true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// 未対応のprotocolの場合はfalseを返す
+func castPort(port netv1.NetworkPolicyPort) (Port, bool) {
+	protocol, ok := castProtocol(port.Protocol)
+	if !ok {
+		return Port{}, false
+	}
+	return Port{
+		Protocol: protocol,
+		Port:     castPortNumber(port.Port),
+		EndPort:  castEndPort(port.EndPort),
+	}, true
+}
+
+// protocolの指定がない場合はapiserverのデフォルトと同じくTCPとして扱う．TCP, UDP, SCTP以外はfalseを返す
+func castProtocol(protocol *v1.Protocol) (string, bool) {
+	if protocol == nil {
+		return "TCP", true
+	}
+
+	switch *protocol {
+	case v1.ProtocolTCP:
+		return "TCP", true
+	case v1.ProtocolUDP:
+		return "UDP", true
+	case v1.ProtocolSCTP:
+		return "SCTP", true
+	default:
+		return "", false
+	}
+}
+
+func castPortNumber(port *intstr.IntOrString) int {
+	if port == nil {
+		return 0
+	}
+
+	return int(port.IntVal)
+}
+
+func castEndPort(endPort *int32) int {
+	if endPort == nil {
+		return 0
+	}
+
+	return int(*endPort)
+}
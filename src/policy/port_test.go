@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func protocolPtr(p v1.Protocol) *v1.Protocol {
+	return &p
+}
+
+func portPtr(p intstr.IntOrString) *intstr.IntOrString {
+	return &p
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestResolvePolicyPorts(t *testing.T) {
+	destPod := v1.Pod{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Ports: []v1.ContainerPort{
+					{Name: "http", ContainerPort: 8080},
+					{Name: "dns", ContainerPort: 5353, Protocol: v1.ProtocolUDP},
+				},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		ports  []netv1.NetworkPolicyPort
+		want   []Port
+		wantOk bool
+	}{
+		{
+			name:   "指定なしは全ポート",
+			ports:  nil,
+			want:   []Port{{Protocol: "any"}},
+			wantOk: true,
+		},
+		{
+			name:   "protocolの省略はTCP",
+			ports:  []netv1.NetworkPolicyPort{{Port: portPtr(intstr.FromInt(80))}},
+			want:   []Port{{Protocol: "TCP", Port: 80}},
+			wantOk: true,
+		},
+		{
+			name:   "endPortで範囲を指定",
+			ports:  []netv1.NetworkPolicyPort{{Protocol: protocolPtr(v1.ProtocolUDP), Port: portPtr(intstr.FromInt(30000)), EndPort: int32Ptr(32767)}},
+			want:   []Port{{Protocol: "UDP", Port: 30000, EndPort: 32767}},
+			wantOk: true,
+		},
+		{
+			name:   "portの省略はプロトコルの全ポート",
+			ports:  []netv1.NetworkPolicyPort{{Protocol: protocolPtr(v1.ProtocolSCTP)}},
+			want:   []Port{{Protocol: "SCTP"}},
+			wantOk: true,
+		},
+		{
+			name:   "名前付きポートはコンテナポートで解決する",
+			ports:  []netv1.NetworkPolicyPort{{Port: portPtr(intstr.FromString("http"))}},
+			want:   []Port{{Protocol: "TCP", Port: 8080, Name: "http"}},
+			wantOk: true,
+		},
+		{
+			name:   "名前付きポートはプロトコルも一致する必要がある",
+			ports:  []netv1.NetworkPolicyPort{{Port: portPtr(intstr.FromString("dns"))}},
+			want:   []Port{},
+			wantOk: false,
+		},
+		{
+			name:   "解決できない名前付きポートは除外する",
+			ports:  []netv1.NetworkPolicyPort{{Port: portPtr(intstr.FromString("metrics"))}, {Protocol: protocolPtr(v1.ProtocolUDP), Port: portPtr(intstr.FromString("dns"))}},
+			want:   []Port{{Protocol: "UDP", Port: 5353, Name: "dns"}},
+			wantOk: true,
+		},
+		{
+			name:   "未対応のprotocolは除外する",
+			ports:  []netv1.NetworkPolicyPort{{Protocol: protocolPtr("ICMP"), Port: portPtr(intstr.FromInt(80))}},
+			want:   []Port{},
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolvePolicyPorts(tt.ports, destPod)
+			if ok != tt.wantOk {
+				t.Errorf("resolvePolicyPorts() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !reflect.DeepEqual(got.Ports(), tt.want) {
+				t.Errorf("resolvePolicyPorts() = %v, want %v", got.Ports(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCastProtocol(t *testing.T) {
+	tests := []struct {
+		protocol *v1.Protocol
+		want     string
+		wantOk   bool
+	}{
+		{nil, "TCP", true},
+		{protocolPtr(v1.ProtocolTCP), "TCP", true},
+		{protocolPtr(v1.ProtocolUDP), "UDP", true},
+		{protocolPtr(v1.ProtocolSCTP), "SCTP", true},
+		{protocolPtr("ICMP"), "", false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := castProtocol(tt.protocol); got != tt.want || ok != tt.wantOk {
+			t.Errorf("castProtocol(%v) = (%q, %v), want (%q, %v)", tt.protocol, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package policy
+
+import (
+	"sort"
+)
+
+const (
+	minPort = 1
+	maxPort = 65535
+)
+
+// "any"を展開したときのプロトコル一覧
+var protocols = []string{"TCP", "UDP", "SCTP"}
+
+// portRange は[start, end]の閉区間
+type portRange struct {
+	start int
+	end   int
+}
+
+// PortSet はプロトコルごとのポート範囲の集合．範囲は常に昇順で重複，隣接のない形に正規化して持つ
+type PortSet struct {
+	ranges map[string][]portRange
+	// 名前付きポートから解決したポートの元の名前
+	names map[string]map[int]string
+}
+
+func EmptyPortSet() PortSet {
+	return PortSet{
+		ranges: make(map[string][]portRange),
+		names:  make(map[string]map[int]string),
+	}
+}
+
+func AllPortSet() PortSet {
+	s := EmptyPortSet()
+	for _, protocol := range protocols {
+		s.ranges[protocol] = []portRange{{start: minPort, end: maxPort}}
+	}
+	return s
+}
+
+// NewPortSet はポート一覧の和集合を作る．空の一覧は空の集合，{Protocol: "any"}は全ポートを表す
+func NewPortSet(ports []Port) PortSet {
+	s := EmptyPortSet()
+	for _, p := range ports {
+		r := portRange{start: p.Port, end: p.EndPort}
+		if p.Port == 0 {
+			r = portRange{start: minPort, end: maxPort}
+		} else if p.EndPort < p.Port {
+			r.end = p.Port
+		}
+
+		for _, protocol := range expandProtocol(p.Protocol) {
+			s.ranges[protocol] = append(s.ranges[protocol], r)
+			if p.Name != "" && r.start == r.end {
+				s.setName(protocol, r.start, p.Name)
+			}
+		}
+	}
+
+	for protocol, ranges := range s.ranges {
+		s.ranges[protocol] = normalizeRanges(ranges)
+	}
+	return s
+}
+
+func (s PortSet) IsEmpty() bool {
+	for _, ranges := range s.ranges {
+		if len(ranges) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s PortSet) IsAll() bool {
+	for _, protocol := range protocols {
+		ranges := s.ranges[protocol]
+		if len(ranges) != 1 || ranges[0].start != minPort || ranges[0].end != maxPort {
+			return false
+		}
+	}
+	return true
+}
+
+func (s PortSet) Union(other PortSet) PortSet {
+	res := EmptyPortSet()
+	for _, protocol := range protocols {
+		ranges := append(append([]portRange{}, s.ranges[protocol]...), other.ranges[protocol]...)
+		if len(ranges) != 0 {
+			res.ranges[protocol] = normalizeRanges(ranges)
+		}
+	}
+	res.mergeNames(s, other)
+	return res
+}
+
+func (s PortSet) Intersect(other PortSet) PortSet {
+	res := EmptyPortSet()
+	for _, protocol := range protocols {
+		ranges := intersectRanges(s.ranges[protocol], other.ranges[protocol])
+		if len(ranges) != 0 {
+			res.ranges[protocol] = ranges
+		}
+	}
+	res.mergeNames(s, other)
+	return res
+}
+
+func (s PortSet) Subtract(other PortSet) PortSet {
+	res := EmptyPortSet()
+	for _, protocol := range protocols {
+		ranges := subtractRanges(s.ranges[protocol], other.ranges[protocol])
+		if len(ranges) != 0 {
+			res.ranges[protocol] = ranges
+		}
+	}
+	res.mergeNames(s)
+	return res
+}
+
+// Contains はprotocol, portの通信が集合に含まれるか判定する．protocolが"any"，portが0の場合はそれぞれいずれかが含まれればよい
+func (s PortSet) Contains(protocol string, port int) bool {
+	for _, p := range expandProtocol(protocol) {
+		for _, r := range s.ranges[p] {
+			if port == 0 || (r.start <= port && port <= r.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Equal は二つの集合が同じポートを含むか判定する(名前付きポートの名前は比較しない)
+func (s PortSet) Equal(other PortSet) bool {
+	return s.Subtract(other).IsEmpty() && other.Subtract(s).IsEmpty()
+}
+
+// Ports は集合を最小の個数のPortの一覧で表す．全プロトコルに共通する範囲は"any"にまとめるので，
+// 全ポートの場合は{Protocol: "any"}の一つ，空の集合の場合は空の一覧になる
+func (s PortSet) Ports() []Port {
+	res := make([]Port, 0)
+
+	common := s.ranges[protocols[0]]
+	for _, protocol := range protocols[1:] {
+		common = intersectRanges(common, s.ranges[protocol])
+	}
+	for _, r := range common {
+		res = append(res, s.toPort("any", r))
+	}
+
+	for _, protocol := range protocols {
+		for _, r := range subtractRanges(s.ranges[protocol], common) {
+			res = append(res, s.toPort(protocol, r))
+		}
+	}
+	return res
+}
+
+func (s PortSet) toPort(protocol string, r portRange) Port {
+	if r.start == minPort && r.end == maxPort {
+		return Port{Protocol: protocol}
+	}
+
+	if r.start == r.end {
+		return Port{Protocol: protocol, Port: r.start, Name: s.getName(protocol, r.start)}
+	}
+
+	return Port{Protocol: protocol, Port: r.start, EndPort: r.end}
+}
+
+func (s PortSet) setName(protocol string, port int, name string) {
+	if _, ok := s.names[protocol]; !ok {
+		s.names[protocol] = make(map[int]string)
+	}
+	s.names[protocol][port] = name
+}
+
+func (s PortSet) getName(protocol string, port int) string {
+	for _, p := range expandProtocol(protocol) {
+		if name, ok := s.names[p][port]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// 結果に含まれる単一ポートについてのみ元の名前を引き継ぐ
+func (s PortSet) mergeNames(sets ...PortSet) {
+	for _, other := range sets {
+		for protocol, names := range other.names {
+			for port, name := range names {
+				if s.Contains(protocol, port) && s.getName(protocol, port) == "" {
+					s.setName(protocol, port, name)
+				}
+			}
+		}
+	}
+}
+
+func expandProtocol(protocol string) []string {
+	if protocol == "any" {
+		return protocols
+	}
+	return []string{protocol}
+}
+
+func normalizeRanges(ranges []portRange) []portRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sorted := append([]portRange{}, ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
+	})
+
+	res := make([]portRange, 0, len(sorted))
+	current := sorted[0]
+	for _, r := range sorted[1:] {
+		// 重複または隣接していれば結合する
+		if r.start <= current.end+1 {
+			if r.end > current.end {
+				current.end = r.end
+			}
+			continue
+		}
+		res = append(res, current)
+		current = r
+	}
+	return append(res, current)
+}
+
+// 正規化済みの範囲同士の積集合
+func intersectRanges(a []portRange, b []portRange) []portRange {
+	res := make([]portRange, 0)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		start := max(a[i].start, b[j].start)
+		end := min(a[i].end, b[j].end)
+		if start <= end {
+			res = append(res, portRange{start: start, end: end})
+		}
+		if a[i].end < b[j].end {
+			i++
+		} else {
+			j++
+		}
+	}
+	return res
+}
+
+// 正規化済みの範囲同士の差集合(a - b)
+func subtractRanges(a []portRange, b []portRange) []portRange {
+	res := make([]portRange, 0, len(a))
+	for _, r := range a {
+		start := r.start
+		for _, cut := range b {
+			if cut.end < start || cut.start > r.end {
+				continue
+			}
+			if cut.start > start {
+				res = append(res, portRange{start: start, end: cut.start - 1})
+			}
+			start = cut.end + 1
+		}
+		if start <= r.end {
+			res = append(res, portRange{start: start, end: r.end})
+		}
+	}
+	return res
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPortSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []Port
+		want  []Port
+	}{
+		{
+			name:  "空の一覧は空の集合",
+			ports: []Port{},
+			want:  []Port{},
+		},
+		{
+			name:  "anyは全ポート",
+			ports: []Port{{Protocol: "any"}},
+			want:  []Port{{Protocol: "any"}},
+		},
+		{
+			name:  "ポート番号なしはプロトコルの全ポート",
+			ports: []Port{{Protocol: "UDP"}},
+			want:  []Port{{Protocol: "UDP"}},
+		},
+		{
+			name:  "重複と隣接はまとめる",
+			ports: []Port{{Protocol: "TCP", Port: 80, EndPort: 90}, {Protocol: "TCP", Port: 85, EndPort: 100}, {Protocol: "TCP", Port: 101}},
+			want:  []Port{{Protocol: "TCP", Port: 80, EndPort: 101}},
+		},
+		{
+			name:  "endPortがportより小さい場合はportのみ",
+			ports: []Port{{Protocol: "TCP", Port: 443, EndPort: 80}},
+			want:  []Port{{Protocol: "TCP", Port: 443}},
+		},
+		{
+			name:  "全プロトコルに共通する範囲はanyにまとめる",
+			ports: []Port{{Protocol: "any", Port: 53}, {Protocol: "TCP", Port: 80}},
+			want:  []Port{{Protocol: "any", Port: 53}, {Protocol: "TCP", Port: 80}},
+		},
+		{
+			name:  "名前付きポートの名前を残す",
+			ports: []Port{{Protocol: "TCP", Port: 8080, Name: "http"}},
+			want:  []Port{{Protocol: "TCP", Port: 8080, Name: "http"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewPortSet(tt.ports).Ports()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewPortSet(%v).Ports() = %v, want %v", tt.ports, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortSetAlgebra(t *testing.T) {
+	tcp80to90 := NewPortSet([]Port{{Protocol: "TCP", Port: 80, EndPort: 90}})
+	tcp85to95 := NewPortSet([]Port{{Protocol: "TCP", Port: 85, EndPort: 95}})
+	udp53 := NewPortSet([]Port{{Protocol: "UDP", Port: 53}})
+
+	tests := []struct {
+		name string
+		got  PortSet
+		want []Port
+	}{
+		{
+			name: "和集合",
+			got:  tcp80to90.Union(tcp85to95).Union(udp53),
+			want: []Port{{Protocol: "TCP", Port: 80, EndPort: 95}, {Protocol: "UDP", Port: 53}},
+		},
+		{
+			name: "共通部分",
+			got:  tcp80to90.Intersect(tcp85to95),
+			want: []Port{{Protocol: "TCP", Port: 85, EndPort: 90}},
+		},
+		{
+			name: "プロトコルが違えば共通部分は空",
+			got:  tcp80to90.Intersect(udp53),
+			want: []Port{},
+		},
+		{
+			name: "差集合で範囲が分かれる",
+			got:  NewPortSet([]Port{{Protocol: "TCP"}}).Subtract(tcp80to90),
+			want: []Port{{Protocol: "TCP", Port: 1, EndPort: 79}, {Protocol: "TCP", Port: 91, EndPort: 65535}},
+		},
+		{
+			name: "全ポートから一つ除く",
+			got:  AllPortSet().Subtract(udp53),
+			want: []Port{
+				{Protocol: "any", Port: 1, EndPort: 52},
+				{Protocol: "any", Port: 54, EndPort: 65535},
+				{Protocol: "TCP", Port: 53},
+				{Protocol: "SCTP", Port: 53},
+			},
+		},
+		{
+			name: "全て除くと空",
+			got:  tcp80to90.Subtract(AllPortSet()),
+			want: []Port{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got.Ports(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ports() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortSetContains(t *testing.T) {
+	s := NewPortSet([]Port{{Protocol: "TCP", Port: 80, EndPort: 90}})
+
+	tests := []struct {
+		protocol string
+		port     int
+		want     bool
+	}{
+		{"TCP", 80, true},
+		{"TCP", 90, true},
+		{"TCP", 91, false},
+		{"UDP", 80, false},
+		{"any", 85, true},
+		{"TCP", 0, true},
+		{"UDP", 0, false},
+	}
+
+	for _, tt := range tests {
+		if got := s.Contains(tt.protocol, tt.port); got != tt.want {
+			t.Errorf("Contains(%q, %d) = %v, want %v", tt.protocol, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestPortSetIsAllAndEqual(t *testing.T) {
+	if !AllPortSet().IsAll() {
+		t.Errorf("AllPortSet().IsAll() = false")
+	}
+	if !NewPortSet([]Port{{Protocol: "any"}}).Equal(AllPortSet()) {
+		t.Errorf("any is not equal to AllPortSet")
+	}
+	if NewPortSet([]Port{{Protocol: "TCP"}}).IsAll() {
+		t.Errorf("TCP only is all")
+	}
+	if !EmptyPortSet().IsEmpty() || AllPortSet().IsEmpty() {
+		t.Errorf("IsEmpty is wrong")
+	}
+
+	// 名前付きポートの名前は比較しない
+	named := NewPortSet([]Port{{Protocol: "TCP", Port: 8080, Name: "http"}})
+	if !named.Equal(NewPortSet([]Port{{Protocol: "TCP", Port: 8080}})) {
+		t.Errorf("named port is not equal to the same number")
+	}
+}
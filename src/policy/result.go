@@ -0,0 +1,56 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// Result はEngine.Evaluateの評価結果
+type Result struct {
+	Target v1.Pod
+	// Targetに適用されたpolicyの名前一覧
+	PolicyNames []string
+	// Targetに適用されたpolicy
+	AppliedPolicies []PolicySource
+	Peers           []PeerResult
+	// Targetとクラスター外との間で許可されている通信
+	ExternalIngress []ExternalPeer
+	ExternalEgress  []ExternalPeer
+	Warnings        []Warning
+}
+
+// PeerResult はTargetとPod一つとの間の通信可否
+type PeerResult struct {
+	Pod v1.Pod
+	// PodからTargetへの通信
+	Ingress Access
+	// TargetからPodへの通信
+	Egress Access
+}
+
+type Access struct {
+	Allowed bool
+	// 許可されているポート．全ポートの場合は{Protocol: "any"}の一つ，許可されていない場合は空
+	Ports []Port
+	// 許可，拒否の根拠
+	Explanations []Explanation
+	// デュアルスタックでアドレスファミリーによって結果が異なる場合のファミリーごとの結果
+	Families []FamilyAccess
+}
+
+// FamilyAccess はアドレスファミリー(IPv4, IPv6)一つについての通信可否
+type FamilyAccess struct {
+	Family       string
+	Allowed      bool
+	Ports        []Port
+	Explanations []Explanation
+}
+
+// Port はNetworkPolicyPortを数値に直したもの．Protocolが"any"，Portが0の場合はそれぞれ全てを表す．
+// EndPortが0でない場合はPortからEndPortまでの範囲を表す
+type Port struct {
+	Protocol string
+	Port     int
+	EndPort  int
+	// 名前付きポートから解決した場合の元の名前
+	Name string
+}
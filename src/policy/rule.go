@@ -0,0 +1,129 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+)
+
+// Network Policyを評価用に変換する．ルールは全て許可で，policyに選択されたPodはその方向について隔離される
+func compileNetworkPolicy(policy netv1.NetworkPolicy) *compiledPolicy {
+	policyTypes := getPolicyTypes(policy)
+	res := &compiledPolicy{
+		source: PolicySource{
+			Engine:    EngineKubernetes,
+			Tier:      defaultTierName,
+			Name:      policy.Name,
+			Namespace: policy.Namespace,
+		},
+		order: networkPolicyOrder,
+		selects: func(self endpoint) bool {
+			return self.pod.Namespace == policy.Namespace && isIncludedInLabelSelector(self.pod.Labels, &policy.Spec.PodSelector)
+		},
+		hasIngress: hasIngress(policyTypes),
+		hasEgress:  hasEgress(policyTypes),
+	}
+
+	for i, rule := range policy.Spec.Ingress {
+		res.ingress = append(res.ingress, compileNetworkPolicyRule(i, policy.Namespace, rule.From, rule.Ports))
+	}
+	for i, rule := range policy.Spec.Egress {
+		res.egress = append(res.egress, compileNetworkPolicyRule(i, policy.Namespace, rule.To, rule.Ports))
+	}
+	return res
+}
+
+func compileNetworkPolicyRule(index int, policyNamespace string, peers []netv1.NetworkPolicyPeer, ports []netv1.NetworkPolicyPort) compiledRule {
+	// from, toが空の場合はクラスター外も含めた全てが対象
+	externalRanges := allIPRanges
+	if len(peers) != 0 {
+		externalRanges = nil
+		for _, peer := range peers {
+			if peer.IPBlock != nil {
+				externalRanges = append(externalRanges, ipBlockToRanges(peer.IPBlock)...)
+			}
+		}
+	}
+
+	return compiledRule{
+		externalRanges: externalRanges,
+		index:          index,
+		action:         ActionAllow,
+		match: func(self endpoint, peer endpoint) (bool, int, string) {
+			if len(peers) == 0 {
+				// from, toが空のパターン．全namespaceの全podが対象
+				return true, -1, getPeerType(nil)
+			}
+
+			// ここからor条件
+			for i := range peers {
+				isIncluded, _ := isIncludedInPeer(peer, policyNamespace, peers[i])
+				if isIncluded {
+					return true, i, getPeerType(&peers[i])
+				}
+			}
+			return false, -1, ""
+		},
+		ports: func(dest v1.Pod) PortSet {
+			// 名前付きポートは通信先のコンテナポートで解決する．一つも解決できないルールはどの通信も許可しない
+			portSet, _ := resolvePolicyPorts(ports, dest)
+			return portSet
+		},
+	}
+}
+
+// podがpeerにマッチするか判定する．peer内の条件は全てAND条件
+func isIncludedInPeer(ep endpoint, policyNamespace string, peer netv1.NetworkPolicyPeer) (bool, error) {
+	pod, podNamespace := ep.pod, ep.namespace
+	if peer.IPBlock != nil {
+		// ipBlockはselectorと同時に指定できず，namespaceに関係なくIPのみで判定する
+		return isAnyIncludedInIpBlock(peer.IPBlock, ep.ips)
+	}
+
+	// NamespaceSelectorのチェック
+	if peer.NamespaceSelector == nil {
+		// Network Policyが属するNamespaceに属するPodが対象になる
+		if policyNamespace != pod.Namespace {
+			return false, nil
+		}
+	} else {
+		// 通信を受け入れるnamespaceが指定されている場合
+		// podが属しているnamespaceがpeer.NamespaceSelectorにマッチしているかチェックする
+		if !isIncludedInLabelSelector(podNamespace.Labels, peer.NamespaceSelector) {
+			return false, nil
+		}
+	}
+
+	// PodSelectorのチェック
+	return isIncludedInLabelSelector(pod.Labels, peer.PodSelector), nil
+}
+
+// policyTypesが省略されている場合はapiserverと同様にIngressを必ず含め，egressルールがあればEgressも含める
+func getPolicyTypes(policy netv1.NetworkPolicy) []netv1.PolicyType {
+	if len(policy.Spec.PolicyTypes) != 0 {
+		return policy.Spec.PolicyTypes
+	}
+
+	policyTypes := []netv1.PolicyType{netv1.PolicyTypeIngress}
+	if len(policy.Spec.Egress) != 0 {
+		policyTypes = append(policyTypes, netv1.PolicyTypeEgress)
+	}
+	return policyTypes
+}
+
+func hasIngress(types []netv1.PolicyType) bool {
+	for _, v := range types {
+		if v == netv1.PolicyTypeIngress {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEgress(types []netv1.PolicyType) bool {
+	for _, v := range types {
+		if v == netv1.PolicyTypeEgress {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestEndpoint(namespace string, labels map[string]string, namespaceLabels map[string]string, ips ...string) endpoint {
+	return endpoint{
+		pod:       v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "pod", Labels: labels}},
+		namespace: v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: namespaceLabels}},
+		ips:       ips,
+	}
+}
+
+func TestIsIncludedInPeer(t *testing.T) {
+	web := newTestEndpoint("default", map[string]string{"app": "web"}, map[string]string{"team": "a"}, "10.0.0.5")
+	otherNamespace := newTestEndpoint("other", map[string]string{"app": "web"}, map[string]string{"team": "b"}, "10.0.1.5")
+	dualStack := newTestEndpoint("default", nil, nil, "10.0.0.5", "fd00::5")
+
+	tests := []struct {
+		name string
+		ep   endpoint
+		peer netv1.NetworkPolicyPeer
+		want bool
+	}{
+		{
+			name: "podSelectorのみはpolicyのnamespaceのPod",
+			ep:   web,
+			peer: netv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			want: true,
+		},
+		{
+			name: "podSelectorのみは他のnamespaceのPodにマッチしない",
+			ep:   otherNamespace,
+			peer: netv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			want: false,
+		},
+		{
+			name: "空のnamespaceSelectorは全namespace",
+			ep:   otherNamespace,
+			peer: netv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{}},
+			want: true,
+		},
+		{
+			name: "namespaceSelectorとpodSelectorはAND",
+			ep:   otherNamespace,
+			peer: netv1.NetworkPolicyPeer{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			want: false,
+		},
+		{
+			name: "matchExpressions",
+			ep:   web,
+			peer: netv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"db"}},
+			}}},
+			want: true,
+		},
+		{
+			name: "ipBlockのcidrに含まれる",
+			ep:   web,
+			peer: netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.0/16"}},
+			want: true,
+		},
+		{
+			name: "ipBlockのexceptに含まれる",
+			ep:   web,
+			peer: netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.0/16", Except: []string{"10.0.0.0/24"}}},
+			want: false,
+		},
+		{
+			name: "exceptの外",
+			ep:   otherNamespace,
+			peer: netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.0/16", Except: []string{"10.0.0.0/24"}}},
+			want: true,
+		},
+		{
+			name: "ipBlockはnamespaceに関係しない",
+			ep:   otherNamespace,
+			peer: netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: "10.0.1.5/32"}},
+			want: true,
+		},
+		{
+			name: "デュアルスタックはいずれかのIPが含まれればよい",
+			ep:   dualStack,
+			peer: netv1.NetworkPolicyPeer{IPBlock: &netv1.IPBlock{CIDR: "fd00::/64"}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := isIncludedInPeer(tt.ep, "default", tt.peer)
+			if err != nil {
+				t.Fatalf("isIncludedInPeer() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isIncludedInPeer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPolicyTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		spec netv1.NetworkPolicySpec
+		want []netv1.PolicyType
+	}{
+		{
+			name: "省略時はIngress",
+			spec: netv1.NetworkPolicySpec{},
+			want: []netv1.PolicyType{netv1.PolicyTypeIngress},
+		},
+		{
+			name: "省略時もegressルールがあればEgressを含む",
+			spec: netv1.NetworkPolicySpec{Egress: []netv1.NetworkPolicyEgressRule{{}}},
+			want: []netv1.PolicyType{netv1.PolicyTypeIngress, netv1.PolicyTypeEgress},
+		},
+		{
+			name: "指定されていればそのまま",
+			spec: netv1.NetworkPolicySpec{PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeEgress}},
+			want: []netv1.PolicyType{netv1.PolicyTypeEgress},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getPolicyTypes(netv1.NetworkPolicy{Spec: tt.spec})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getPolicyTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileNetworkPolicyRule(t *testing.T) {
+	peers := []netv1.NetworkPolicyPeer{
+		{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}},
+		{IPBlock: &netv1.IPBlock{CIDR: "10.0.0.0/16", Except: []string{"10.0.0.0/24"}}},
+	}
+	rule := compileNetworkPolicyRule(0, "default", peers, nil)
+
+	self := newTestEndpoint("default", map[string]string{"app": "web"}, nil, "10.1.0.1")
+	tests := []struct {
+		name          string
+		peer          endpoint
+		wantOk        bool
+		wantPeerIndex int
+		wantPeerType  string
+	}{
+		{"podSelectorにマッチ", newTestEndpoint("default", map[string]string{"app": "db"}, nil, "10.2.0.1"), true, 0, "podSelector"},
+		{"ipBlockにマッチ", newTestEndpoint("other", nil, nil, "10.0.1.1"), true, 1, "ipBlock"},
+		{"exceptに含まれる", newTestEndpoint("other", nil, nil, "10.0.0.1"), false, -1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, peerIndex, peerType := rule.match(self, tt.peer)
+			if ok != tt.wantOk || peerIndex != tt.wantPeerIndex || peerType != tt.wantPeerType {
+				t.Errorf("match() = (%v, %d, %q), want (%v, %d, %q)", ok, peerIndex, peerType, tt.wantOk, tt.wantPeerIndex, tt.wantPeerType)
+			}
+		})
+	}
+
+	// クラスター外の範囲はexceptを除いたipBlockのみ
+	var cidrs []string
+	for _, r := range rule.externalRanges {
+		for _, prefix := range rangeToPrefixes(r) {
+			cidrs = append(cidrs, prefix.String())
+		}
+	}
+	wantCIDRs := []string{"10.0.1.0/24", "10.0.2.0/23", "10.0.4.0/22", "10.0.8.0/21", "10.0.16.0/20", "10.0.32.0/19", "10.0.64.0/18", "10.0.128.0/17"}
+	if !reflect.DeepEqual(cidrs, wantCIDRs) {
+		t.Errorf("externalRanges = %v, want %v", cidrs, wantCIDRs)
+	}
+}
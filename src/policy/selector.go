@@ -0,0 +1,111 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"net"
+)
+
+// apimachineryのLabelSelectorAsSelectorと同じ意味でラベルがselectorにマッチするか判定する．
+// nilは全てにマッチし，不正なselectorはどれにもマッチしない(警告はvalidatePolicyで検出する)
+func isIncludedInLabelSelector(labelMap map[string]string, labelSelector *metav1.LabelSelector) bool {
+	if labelSelector == nil {
+		return true
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return false
+	}
+
+	return selector.Matches(labels.Set(labelMap))
+}
+
+func isIncludedInIpBlock(ipBlock *netv1.IPBlock, ip string) (bool, error) {
+	if ipBlock == nil {
+		// ipBlockに関する条件がないのでtrueで返す
+		return true, nil
+	}
+
+	_, cidrNet, err := net.ParseCIDR(ipBlock.CIDR)
+	if err != nil {
+		return false, err
+	}
+
+	targetIP := net.ParseIP(ip)
+	if !cidrNet.Contains(targetIP) {
+		return false, nil
+	}
+
+	if len(ipBlock.Except) > 0 {
+		for _, v := range ipBlock.Except {
+			_, exceptCidrNet, err := net.ParseCIDR(v)
+			if err != nil {
+				return false, err
+			}
+			if exceptCidrNet.Contains(targetIP) {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// ipsのいずれかがipBlockに含まれるか判定する．ipBlockは一つのアドレスファミリーなので，同じファミリーのIPのみが判定対象になる
+func isAnyIncludedInIpBlock(ipBlock *netv1.IPBlock, ips []string) (bool, error) {
+	for _, ip := range ips {
+		isIncluded, err := isIncludedInIpBlock(ipBlock, ip)
+		if err != nil || isIncluded {
+			return isIncluded, err
+		}
+	}
+	return false, nil
+}
+
+const (
+	IPFamilyIPv4 = "IPv4"
+	IPFamilyIPv6 = "IPv6"
+)
+
+// GetPodIPs はPodの全てのIPを返す．デュアルスタックではPodIPsに両方のファミリーのIPが入り，先頭がPodIPと同じになる
+func GetPodIPs(pod v1.Pod) []string {
+	if len(pod.Status.PodIPs) != 0 {
+		ips := make([]string, 0, len(pod.Status.PodIPs))
+		for _, v := range pod.Status.PodIPs {
+			ips = append(ips, v.IP)
+		}
+		return ips
+	}
+	if pod.Status.PodIP != "" {
+		return []string{pod.Status.PodIP}
+	}
+	return []string{}
+}
+
+func getIPFamily(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if parsed.To4() != nil {
+		return IPFamilyIPv4
+	}
+	return IPFamilyIPv6
+}
+
+// ipsのうちfamilyのものを返す．familyが空の場合は全て
+func filterIPsByFamily(ips []string, family string) []string {
+	if family == "" {
+		return ips
+	}
+	res := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if getIPFamily(ip) == family {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Overlay は既存のNetwork Policyに重ねる変更．Applyは同じnamespace, nameのものがあれば置き換え，なければ追加する
+type Overlay struct {
+	Apply  []netv1.NetworkPolicy
+	Delete []types.NamespacedName
+}
+
+// OverlayResult はOverlayを適用した結果どのpolicyが追加，置換，削除されたか
+type OverlayResult struct {
+	Added    []types.NamespacedName
+	Replaced []types.NamespacedName
+	Deleted  []types.NamespacedName
+	// 削除対象として指定されたが存在しなかったもの
+	NotFound []types.NamespacedName
+}
+
+// ApplyTo はpoliciesにOverlayを適用した新しい一覧を返す．policiesは変更しない
+func (o Overlay) ApplyTo(policies []netv1.NetworkPolicy) ([]netv1.NetworkPolicy, OverlayResult) {
+	var result OverlayResult
+	res := append(make([]netv1.NetworkPolicy, 0, len(policies)+len(o.Apply)), policies...)
+
+	for _, key := range o.Delete {
+		index := findPolicy(res, key)
+		if index < 0 {
+			result.NotFound = append(result.NotFound, key)
+			continue
+		}
+		res = append(res[:index], res[index+1:]...)
+		result.Deleted = append(result.Deleted, key)
+	}
+
+	for _, policy := range o.Apply {
+		key := types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}
+		index := findPolicy(res, key)
+		if index < 0 {
+			res = append(res, policy)
+			result.Added = append(result.Added, key)
+			continue
+		}
+		res[index] = policy
+		result.Replaced = append(result.Replaced, key)
+	}
+
+	return res, result
+}
+
+func findPolicy(policies []netv1.NetworkPolicy, key types.NamespacedName) int {
+	for i, policy := range policies {
+		if policy.Namespace == key.Namespace && policy.Name == key.Name {
+			return i
+		}
+	}
+	return -1
+}
+
+// FlowChange はFromからToへの通信で新たに許可，拒否されたポート
+type FlowChange struct {
+	From  v1.Pod
+	To    v1.Pod
+	Ports []Port
+}
+
+// IsolationChange はPodがその方向について隔離された，または隔離が解除されたこと
+type IsolationChange struct {
+	Pod       v1.Pod
+	Direction Direction
+	Isolated  bool
+}
+
+type SimulationResult struct {
+	Overlay          OverlayResult
+	NewlyAllowed     []FlowChange
+	NewlyDenied      []FlowChange
+	IsolationChanges []IsolationChange
+	// Overlay適用後のpolicyについての警告
+	Warnings []Warning
+}
+
+// Simulate はOverlayの適用前後で全Pod間の通信可否を比較する．OverlayはNetwork Policyにのみ適用し，
+// Calico等のpolicyは前後どちらの評価にもそのまま含める．クラスタには何も書き込まない
+func Simulate(pods []v1.Pod, namespaces []v1.Namespace, policySet PolicySet, overlay Overlay) (SimulationResult, error) {
+	afterPolicySet := policySet
+	var overlayResult OverlayResult
+	afterPolicySet.NetworkPolicies, overlayResult = overlay.ApplyTo(policySet.NetworkPolicies)
+	beforeEngine := NewEngineWithPolicySet(pods, namespaces, policySet)
+	afterEngine := NewEngineWithPolicySet(pods, namespaces, afterPolicySet)
+
+	before, err := beforeEngine.Matrix(pods)
+	if err != nil {
+		return SimulationResult{}, err
+	}
+	after, err := afterEngine.Matrix(pods)
+	if err != nil {
+		return SimulationResult{}, err
+	}
+
+	res := SimulationResult{
+		Overlay:          overlayResult,
+		NewlyAllowed:     make([]FlowChange, 0),
+		NewlyDenied:      make([]FlowChange, 0),
+		IsolationChanges: make([]IsolationChange, 0),
+		Warnings:         afterEngine.Warnings(),
+	}
+
+	beforePortSets := getCellPortSets(before)
+	afterPortSets := getCellPortSets(after)
+	for from, fromPod := range pods {
+		for to, toPod := range pods {
+			beforePorts, ok := beforePortSets[[2]int{from, to}]
+			if !ok {
+				beforePorts = EmptyPortSet()
+			}
+			afterPorts, ok := afterPortSets[[2]int{from, to}]
+			if !ok {
+				afterPorts = EmptyPortSet()
+			}
+
+			if allowed := afterPorts.Subtract(beforePorts); !allowed.IsEmpty() {
+				res.NewlyAllowed = append(res.NewlyAllowed, FlowChange{From: fromPod, To: toPod, Ports: allowed.Ports()})
+			}
+			if denied := beforePorts.Subtract(afterPorts); !denied.IsEmpty() {
+				res.NewlyDenied = append(res.NewlyDenied, FlowChange{From: fromPod, To: toPod, Ports: denied.Ports()})
+			}
+		}
+	}
+
+	for _, pod := range pods {
+		beforeIngress, beforeEgress := beforeEngine.IsIsolated(pod)
+		afterIngress, afterEgress := afterEngine.IsIsolated(pod)
+		if beforeIngress != afterIngress {
+			res.IsolationChanges = append(res.IsolationChanges, IsolationChange{Pod: pod, Direction: DirectionIngress, Isolated: afterIngress})
+		}
+		if beforeEgress != afterEgress {
+			res.IsolationChanges = append(res.IsolationChanges, IsolationChange{Pod: pod, Direction: DirectionEgress, Isolated: afterEgress})
+		}
+	}
+
+	return res, nil
+}
+
+func getCellPortSets(matrix Matrix) map[[2]int]PortSet {
+	m := make(map[[2]int]PortSet, len(matrix.Cells))
+	for _, cell := range matrix.Cells {
+		m[[2]int{cell.From, cell.To}] = NewPortSet(cell.Ports)
+	}
+	return m
+}
@@ -0,0 +1,204 @@
+package policy
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"math"
+	"sort"
+)
+
+type Action string
+
+const (
+	ActionAllow Action = "Allow"
+	ActionDeny  Action = "Deny"
+	// 同じ層の残りのpolicyを飛ばして次の層で評価する
+	ActionPass Action = "Pass"
+)
+
+const (
+	EngineKubernetes = "kubernetes"
+	EngineCalico     = "calico"
+	EngineCilium     = "cilium"
+)
+
+// Network PolicyはCalicoと同じくdefault層のorder 1000のpolicyとして扱う．orderのないpolicy, 層は最後に評価する．
+// default層のorderはTierで指定されていなければCalicoのデフォルトの1000000
+const (
+	defaultTierName      = "default"
+	defaultTierOrder     = 1000000
+	networkPolicyOrder   = 1000
+	unorderedPolicyOrder = math.MaxFloat64
+)
+
+// PolicySource はルールを定義しているpolicy
+type PolicySource struct {
+	Engine    string
+	Tier      string
+	Name      string
+	Namespace string
+}
+
+// podと，podが属するnamespace
+type endpoint struct {
+	pod       v1.Pod
+	namespace v1.Namespace
+	// ipBlock等の判定に使うIP．アドレスファミリーごとに評価する場合はそのファミリーのIPのみ
+	ips []string
+}
+
+// compiledRule は評価用に変換したルール一つ
+type compiledRule struct {
+	index  int
+	action Action
+	// ruleがendpoint(policyが適用されたPod)と通信相手peerについてマッチするか．
+	// マッチした場合はpeerのインデックス(該当しない場合は-1)と種類を返す
+	match func(self endpoint, peer endpoint) (bool, int, string)
+	// ルールが対象とするポート．destは通信先Pod(名前付きポートの解決用)
+	ports func(dest v1.Pod) PortSet
+	// ルールがマッチするクラスター外のIPの範囲(ipBlock, Ciliumのfrom/toCIDR, Calicoのnets, AdminNetworkPolicyのnetworks)
+	externalRanges []ipRange
+}
+
+// compiledPolicy は評価用に変換したpolicy
+type compiledPolicy struct {
+	source PolicySource
+	order  float64
+	// policyがPodを選択するか
+	selects    func(self endpoint) bool
+	hasIngress bool
+	hasEgress  bool
+	// このpolicyだけではPodを隔離しない(CiliumのenableDefaultDenyがfalse)
+	defaultAllowIngress bool
+	defaultAllowEgress  bool
+	ingress             []compiledRule
+	egress              []compiledRule
+}
+
+func (p *compiledPolicy) rules(direction Direction) []compiledRule {
+	if direction == DirectionIngress {
+		return p.ingress
+	}
+	return p.egress
+}
+
+func (p *compiledPolicy) appliesTo(direction Direction) bool {
+	if direction == DirectionIngress {
+		return p.hasIngress
+	}
+	return p.hasEgress
+}
+
+func (p *compiledPolicy) isolates(direction Direction) bool {
+	if direction == DirectionIngress {
+		return p.hasIngress && !p.defaultAllowIngress
+	}
+	return p.hasEgress && !p.defaultAllowEgress
+}
+
+// compiledTier は評価の層．層の中のpolicyはorder順に評価し，最初にマッチしたルールの動作に従う
+type compiledTier struct {
+	name  string
+	order float64
+	// 層のpolicyがPodを選択していれば，どのルールにもマッチしなかった通信を拒否する
+	defaultDeny bool
+	policies    []*compiledPolicy
+}
+
+func sortPolicies(policies []*compiledPolicy) {
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].order != policies[j].order {
+			return policies[i].order < policies[j].order
+		}
+		return policies[i].source.Name < policies[j].source.Name
+	})
+}
+
+func sortTiers(tiers []*compiledTier) {
+	sort.SliceStable(tiers, func(i, j int) bool {
+		if tiers[i].order != tiers[j].order {
+			return tiers[i].order < tiers[j].order
+		}
+		return tiers[i].name < tiers[j].name
+	})
+}
+
+// appliedTier はある方向についてPodを選択しているpolicyのみを残した層
+type appliedTier struct {
+	tier     *compiledTier
+	policies []*compiledPolicy
+	// どのルールにもマッチしなかった通信を拒否するか
+	defaultDeny bool
+}
+
+// 片側のPodに適用されたpolicyによる判定結果
+type sideResult struct {
+	ports        PortSet
+	ok           bool
+	explanations []Explanation
+}
+
+// evaluateSide はselfに適用された層を順に評価し，peerとの通信で許可されるポートを求める．
+// ポートごとに最初にマッチしたルールの動作に従い，どの層でも決まらなかったポートは許可する
+func evaluateSide(tiers []appliedTier, self endpoint, peer endpoint, direction Direction) sideResult {
+	dest := peer.pod
+	if direction == DirectionIngress {
+		dest = self.pod
+	}
+
+	res := sideResult{ports: EmptyPortSet()}
+	remaining := AllPortSet()
+	isolated := false
+	for _, t := range tiers {
+		passed := EmptyPortSet()
+		allowedInTier := false
+		for _, policy := range t.policies {
+			for _, rule := range policy.rules(direction) {
+				if remaining.IsEmpty() {
+					break
+				}
+				ok, peerIndex, peerType := rule.match(self, peer)
+				if !ok {
+					continue
+				}
+				ports := rule.ports(dest).Intersect(remaining)
+				if ports.IsEmpty() {
+					continue
+				}
+
+				explanation := newRuleExplanation(direction, policy.source, rule, peerIndex, peerType)
+				switch rule.action {
+				case ActionAllow:
+					res.ports = res.ports.Union(ports)
+					allowedInTier = true
+				case ActionPass:
+					passed = passed.Union(ports)
+				}
+				res.explanations = append(res.explanations, explanation)
+				remaining = remaining.Subtract(ports)
+			}
+		}
+
+		if t.defaultDeny {
+			isolated = true
+			if !remaining.IsEmpty() {
+				// 隔離されているがどのルールにもマッチしなかった
+				if !allowedInTier {
+					res.explanations = append(res.explanations, newNoRuleMatchedExplanations(direction, t.policies)...)
+				}
+				remaining = EmptyPortSet()
+			}
+		}
+		remaining = remaining.Union(passed)
+	}
+
+	if !remaining.IsEmpty() {
+		// どの層でも決まらなかった通信は許可
+		res.ports = res.ports.Union(remaining)
+		if !isolated {
+			res.explanations = append(res.explanations, newNotIsolatedExplanation(direction))
+		}
+	}
+
+	res.ok = !res.ports.IsEmpty()
+	return res
+}
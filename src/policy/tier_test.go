@@ -0,0 +1,228 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// 全ての通信相手にマッチし，portsのポートを対象とするルール
+func newTestRule(action Action, ports ...Port) compiledRule {
+	portSet := AllPortSet()
+	if len(ports) != 0 {
+		portSet = NewPortSet(ports)
+	}
+	return compiledRule{
+		action: action,
+		match: func(self endpoint, peer endpoint) (bool, int, string) {
+			return true, -1, "all"
+		},
+		ports: func(dest v1.Pod) PortSet {
+			return portSet
+		},
+	}
+}
+
+// どの通信相手にもマッチしないルール
+func newTestUnmatchedRule(action Action) compiledRule {
+	rule := newTestRule(action)
+	rule.match = func(self endpoint, peer endpoint) (bool, int, string) {
+		return false, -1, ""
+	}
+	return rule
+}
+
+func newTestPolicy(tier string, name string, order float64, rules ...compiledRule) *compiledPolicy {
+	for i := range rules {
+		rules[i].index = i
+	}
+	return &compiledPolicy{
+		source:     PolicySource{Engine: EngineCalico, Tier: tier, Name: name},
+		order:      order,
+		hasIngress: true,
+		ingress:    rules,
+	}
+}
+
+func newTestTier(name string, order float64, defaultDeny bool, policies ...*compiledPolicy) appliedTier {
+	t := &compiledTier{name: name, order: order, defaultDeny: defaultDeny, policies: policies}
+	return appliedTier{tier: t, policies: policies, defaultDeny: defaultDeny}
+}
+
+func TestEvaluateSide(t *testing.T) {
+	tcp80 := Port{Protocol: "TCP", Port: 80}
+
+	tests := []struct {
+		name        string
+		tiers       []appliedTier
+		wantPorts   []Port
+		wantReasons []Reason
+	}{
+		{
+			name:        "隔離されていなければ全ポート許可",
+			tiers:       nil,
+			wantPorts:   []Port{{Protocol: "any"}},
+			wantReasons: []Reason{ReasonNotIsolated},
+		},
+		{
+			name: "隔離されていてどのルールにもマッチしなければ拒否",
+			tiers: []appliedTier{
+				newTestTier("default", 1, true, newTestPolicy("default", "p", 1, newTestUnmatchedRule(ActionAllow))),
+			},
+			wantPorts:   []Port{},
+			wantReasons: []Reason{ReasonNoRuleMatched},
+		},
+		{
+			name: "前の層のDenyが後の層のAllowより優先する",
+			tiers: []appliedTier{
+				newTestTier("security", 1, true, newTestPolicy("security", "deny", 1, newTestRule(ActionDeny))),
+				newTestTier("default", 2, true, newTestPolicy("default", "allow", 1, newTestRule(ActionAllow))),
+			},
+			wantPorts:   []Port{},
+			wantReasons: []Reason{ReasonRuleDenied},
+		},
+		{
+			name: "層の中では最初にマッチしたルールに従う",
+			tiers: []appliedTier{
+				newTestTier("default", 1, true,
+					newTestPolicy("default", "allow", 1, newTestRule(ActionAllow)),
+					newTestPolicy("default", "deny", 2, newTestRule(ActionDeny)),
+				),
+			},
+			wantPorts:   []Port{{Protocol: "any"}},
+			wantReasons: []Reason{ReasonRuleMatched},
+		},
+		{
+			name: "ポートごとに最初にマッチしたルールに従う",
+			tiers: []appliedTier{
+				newTestTier("default", 1, true, newTestPolicy("default", "p", 1,
+					newTestRule(ActionDeny, tcp80),
+					newTestRule(ActionAllow),
+				)),
+			},
+			wantPorts: []Port{
+				{Protocol: "any", Port: 1, EndPort: 79},
+				{Protocol: "any", Port: 81, EndPort: 65535},
+				{Protocol: "UDP", Port: 80},
+				{Protocol: "SCTP", Port: 80},
+			},
+			wantReasons: []Reason{ReasonRuleDenied, ReasonRuleMatched},
+		},
+		{
+			name: "Passは層の残りを飛ばして次の層で評価する",
+			tiers: []appliedTier{
+				newTestTier("security", 1, true,
+					newTestPolicy("security", "pass", 1, newTestRule(ActionPass)),
+					newTestPolicy("security", "deny", 2, newTestRule(ActionDeny)),
+				),
+				newTestTier("default", 2, true, newTestPolicy("default", "allow", 1, newTestRule(ActionAllow, tcp80))),
+			},
+			wantPorts:   []Port{tcp80},
+			wantReasons: []Reason{ReasonPassed, ReasonRuleMatched},
+		},
+		{
+			name: "Passした通信は次の層がなければ許可",
+			tiers: []appliedTier{
+				newTestTier("security", 1, true, newTestPolicy("security", "pass", 1, newTestRule(ActionPass))),
+			},
+			wantPorts:   []Port{{Protocol: "any"}},
+			wantReasons: []Reason{ReasonPassed},
+		},
+		{
+			name: "隔離しない層で決まらなかった通信は次の層で評価する",
+			tiers: []appliedTier{
+				newTestTier("baseline", 1, false, newTestPolicy("baseline", "allow", 1, newTestRule(ActionAllow, tcp80))),
+				newTestTier("default", 2, true, newTestPolicy("default", "deny", 1, newTestRule(ActionDeny))),
+			},
+			wantPorts:   []Port{tcp80},
+			wantReasons: []Reason{ReasonRuleMatched, ReasonRuleDenied},
+		},
+	}
+
+	self := newTestEndpoint("default", nil, nil, "10.0.0.1")
+	peer := newTestEndpoint("default", nil, nil, "10.0.0.2")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := evaluateSide(tt.tiers, self, peer, DirectionIngress)
+			if got := res.ports.Ports(); !reflect.DeepEqual(got, tt.wantPorts) {
+				t.Errorf("ports = %v, want %v", got, tt.wantPorts)
+			}
+			if res.ok != (len(tt.wantPorts) != 0) {
+				t.Errorf("ok = %v", res.ok)
+			}
+			reasons := make([]Reason, 0, len(res.explanations))
+			for _, e := range res.explanations {
+				reasons = append(reasons, e.Reason)
+			}
+			if !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("reasons = %v, want %v", reasons, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestSortTiersAndPolicies(t *testing.T) {
+	tiers := []*compiledTier{
+		{name: "default", order: unorderedPolicyOrder},
+		{name: "b", order: 100},
+		{name: "a", order: 100},
+		{name: "security", order: 1},
+	}
+	sortTiers(tiers)
+	gotTiers := make([]string, 0, len(tiers))
+	for _, t := range tiers {
+		gotTiers = append(gotTiers, t.name)
+	}
+	if want := []string{"security", "a", "b", "default"}; !reflect.DeepEqual(gotTiers, want) {
+		t.Errorf("sortTiers() = %v, want %v", gotTiers, want)
+	}
+
+	policies := []*compiledPolicy{
+		newTestPolicy("default", "unordered", unorderedPolicyOrder),
+		newTestPolicy("default", "np", networkPolicyOrder),
+		newTestPolicy("default", "calico-b", 10),
+		newTestPolicy("default", "calico-a", 10),
+	}
+	sortPolicies(policies)
+	gotPolicies := make([]string, 0, len(policies))
+	for _, p := range policies {
+		gotPolicies = append(gotPolicies, p.source.Name)
+	}
+	if want := []string{"calico-a", "calico-b", "np", "unordered"}; !reflect.DeepEqual(gotPolicies, want) {
+		t.Errorf("sortPolicies() = %v, want %v", gotPolicies, want)
+	}
+}
+
+func TestDefaultTierOrder(t *testing.T) {
+	early, late := 10.0, 2000000.0
+	tests := []struct {
+		name  string
+		tiers []CalicoTier
+		want  []string
+	}{
+		{
+			name:  "Tierがなければdefault層はorder 1000000",
+			tiers: []CalicoTier{{Name: "late", Order: &late}, {Name: "early", Order: &early}, {Name: "unordered"}},
+			want:  []string{adminTierName, "early", defaultTierName, "late", "unordered", baselineTierName},
+		},
+		{
+			name:  "default層のorderはTierで変えられる",
+			tiers: []CalicoTier{{Name: "late", Order: &late}, {Name: defaultTierName, Order: &early}},
+			want:  []string{adminTierName, defaultTierName, "late", baselineTierName},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngineWithPolicySet(nil, nil, PolicySet{CalicoTiers: tt.tiers})
+			got := make([]string, 0, len(engine.tiers))
+			for _, tier := range engine.tiers {
+				got = append(got, tier.name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tiers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package policy
+
+import (
+	"encoding/json"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// dynamic clientで取得したオブジェクトのspecを構造体に変換する
+func convertUnstructuredSpec(obj unstructured.Unstructured, spec interface{}) error {
+	b, err := json.Marshal(obj.Object["spec"])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, spec)
+}
+
+// dynamic clientで取得したオブジェクト全体を構造体に変換する
+func convertUnstructuredObject(obj unstructured.Unstructured, v interface{}) error {
+	b, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,134 @@
+package policy
+
+import (
+	"fmt"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"net"
+)
+
+const (
+	WarningCodeInvalidSelector = "InvalidSelector"
+	WarningCodeInvalidCIDR     = "InvalidCIDR"
+	WarningCodeInvalidAction   = "InvalidAction"
+	WarningCodeInvalidPort     = "InvalidPort"
+	// TCP, UDP, SCTP以外のprotocol．policyは除外せずそのポートのみ無視する
+	WarningCodeUnsupportedProtocol = "UnsupportedProtocol"
+	// CRDのオブジェクトがpolicyの構造体に変換できない
+	WarningCodeInvalidObject = "InvalidObject"
+)
+
+// Warning は評価できなかったpolicyの記述．警告のあるpolicyは評価から除外される(UnsupportedProtocolを除く)
+type Warning struct {
+	// policyの種類(NetworkPolicy, GlobalNetworkPolicy, CiliumNetworkPolicy等)
+	Kind       string
+	PolicyName string
+	Namespace  string
+	Code       string
+	// 問題のあるフィールドのパス(例: spec.ingress[0].from[1].podSelector)
+	Field   string
+	Message string
+}
+
+// NewObjectWarning はdynamic clientで取得したが変換できなかったオブジェクトの警告を作る
+func NewObjectWarning(obj unstructured.Unstructured, err error) Warning {
+	return Warning{
+		Kind:       obj.GetKind(),
+		PolicyName: obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+		Code:       WarningCodeInvalidObject,
+		Field:      "spec",
+		Message:    err.Error(),
+	}
+}
+
+// Network Policyのselector, ipBlockを検査し，評価できないものを警告として返す
+func validatePolicy(policy netv1.NetworkPolicy) []Warning {
+	warnings := make([]Warning, 0)
+	addWarning := func(code string, field string, err error) {
+		warnings = append(warnings, Warning{
+			Kind:       "NetworkPolicy",
+			PolicyName: policy.Name,
+			Namespace:  policy.Namespace,
+			Code:       code,
+			Field:      field,
+			Message:    err.Error(),
+		})
+	}
+
+	if err := validateLabelSelector(&policy.Spec.PodSelector); err != nil {
+		addWarning(WarningCodeInvalidSelector, "spec.podSelector", err)
+	}
+
+	addPeerWarnings := func(field string, peer netv1.NetworkPolicyPeer) {
+		if err := validateLabelSelector(peer.NamespaceSelector); err != nil {
+			addWarning(WarningCodeInvalidSelector, field+".namespaceSelector", err)
+		}
+		if err := validateLabelSelector(peer.PodSelector); err != nil {
+			addWarning(WarningCodeInvalidSelector, field+".podSelector", err)
+		}
+		if peer.IPBlock == nil {
+			return
+		}
+		if _, _, err := net.ParseCIDR(peer.IPBlock.CIDR); err != nil {
+			addWarning(WarningCodeInvalidCIDR, field+".ipBlock.cidr", err)
+		}
+		for i, except := range peer.IPBlock.Except {
+			if _, _, err := net.ParseCIDR(except); err != nil {
+				addWarning(WarningCodeInvalidCIDR, fmt.Sprintf("%s.ipBlock.except[%d]", field, i), err)
+			}
+		}
+	}
+
+	for i, rule := range policy.Spec.Ingress {
+		for j, peer := range rule.From {
+			addPeerWarnings(fmt.Sprintf("spec.ingress[%d].from[%d]", i, j), peer)
+		}
+	}
+
+	for i, rule := range policy.Spec.Egress {
+		for j, peer := range rule.To {
+			addPeerWarnings(fmt.Sprintf("spec.egress[%d].to[%d]", i, j), peer)
+		}
+	}
+
+	return warnings
+}
+
+// Network Policyのポートのうち未対応のprotocolのものを警告として返す．そのポートは評価で無視する
+func validatePolicyPorts(policy netv1.NetworkPolicy) []Warning {
+	warnings := make([]Warning, 0)
+	addPortWarnings := func(field string, ports []netv1.NetworkPolicyPort) {
+		for i, port := range ports {
+			if _, ok := castProtocol(port.Protocol); ok {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				Kind:       "NetworkPolicy",
+				PolicyName: policy.Name,
+				Namespace:  policy.Namespace,
+				Code:       WarningCodeUnsupportedProtocol,
+				Field:      fmt.Sprintf("%s.ports[%d].protocol", field, i),
+				Message:    fmt.Sprintf("unsupported protocol %q, the port is ignored", *port.Protocol),
+			})
+		}
+	}
+
+	for i, rule := range policy.Spec.Ingress {
+		addPortWarnings(fmt.Sprintf("spec.ingress[%d]", i), rule.Ports)
+	}
+	for i, rule := range policy.Spec.Egress {
+		addPortWarnings(fmt.Sprintf("spec.egress[%d]", i), rule.Ports)
+	}
+	return warnings
+}
+
+func validateLabelSelector(labelSelector *metav1.LabelSelector) error {
+	if labelSelector == nil {
+		return nil
+	}
+
+	_, err := metav1.LabelSelectorAsSelector(labelSelector)
+	return err
+}